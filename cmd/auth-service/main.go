@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"time"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/middleware/cors"
@@ -9,12 +10,17 @@ import (
 	"github.com/gofiber/fiber/v3/middleware/recover"
 	"github.com/rajivgeraev/flippy-api/internal/config"
 	"github.com/rajivgeraev/flippy-api/internal/db"
+	"github.com/rajivgeraev/flippy-api/internal/services/admin"
 	"github.com/rajivgeraev/flippy-api/internal/services/auth"
 	"github.com/rajivgeraev/flippy-api/internal/services/chat"
 	"github.com/rajivgeraev/flippy-api/internal/services/cloudinary"
 	"github.com/rajivgeraev/flippy-api/internal/services/favorite"
 	"github.com/rajivgeraev/flippy-api/internal/services/listing"
+	"github.com/rajivgeraev/flippy-api/internal/services/notification"
+	"github.com/rajivgeraev/flippy-api/internal/services/profile"
+	"github.com/rajivgeraev/flippy-api/internal/services/review"
 	"github.com/rajivgeraev/flippy-api/internal/services/trade"
+	"github.com/rajivgeraev/flippy-api/internal/websocket"
 )
 
 func main() {
@@ -43,16 +49,27 @@ func main() {
 		AllowCredentials: false,
 	}))
 
+	// Создаём менеджер WebSocket соединений
+	wsManager := websocket.NewManager()
+	defer wsManager.Shutdown()
+
 	// Создаём сервисы
-	authService := auth.NewAuthService(cfg)
+	authService := auth.NewAuthService(cfg, wsManager)
 	cloudinaryService := cloudinary.NewCloudinaryService(cfg)
 	listingService := listing.NewListingService(cfg)
-	tradeService := trade.NewTradeService(cfg)
-	chatService := chat.NewChatService(cfg)
+	tradeService := trade.NewTradeService(cfg, wsManager)
+	chatService := chat.NewChatService(cfg, wsManager)
 	favoriteService := favorite.NewFavoriteService(cfg) // Добавляем новый сервис
+	reviewService := review.NewReviewService(cfg)
+	adminService := admin.NewAdminService(cfg)
+	profileService := profile.NewProfileService(cfg)
+	notificationService := notification.NewNotificationService(cfg)
+	wsHandler := websocket.NewHandler(cfg, wsManager)
 
 	// Вначале регистрируем публичные маршруты
 	listingService.SetupPublicRoutes(app)
+	reviewService.SetupPublicRoutes(app)
+	profileService.SetupPublicRoutes(app)
 	// Временный эндпоинт для категорий
 	app.Get("/api/categories", func(c fiber.Ctx) error {
 		categories := []map[string]string{
@@ -83,7 +100,19 @@ func main() {
 	listingService.SetupRoutes(app)
 	tradeService.SetupRoutes(app)
 	chatService.SetupRoutes(app)
-	favoriteService.SetupRoutes(app) // Регистрируем маршруты избранного
+	favoriteService.SetupRoutes(app)     // Регистрируем маршруты избранного
+	reviewService.SetupRoutes(app)       // Отзывы о завершенных обменах
+	adminService.SetupRoutes(app)        // Инструменты модерации
+	profileService.SetupRoutes(app)      // Профиль текущего пользователя
+	notificationService.SetupRoutes(app) // Уведомления, пропущенные вне сети
+	wsHandler.SetupRoutes(app)           // WebSocket для уведомлений в реальном времени
+
+	// Запускаем фоновые задачи
+	listingService.StartExpirationWorker(time.Hour, cfg.ListingTTL)
+	tradeService.StartChatRepairWorker(10 * time.Minute)
+	tradeService.StartConfirmationWatcher(time.Hour, cfg.TradeConfirmTimeout)
+	tradeService.StartExpirationScheduler(15 * time.Minute)
+	tradeService.StartCycleDiscovery(time.Hour)
 
 	// Запускаем сервер
 	log.Println("✅ Flippy API запущен на порту 8080")
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -11,11 +14,40 @@ import (
 // Config структура конфигурации
 type Config struct {
 	TelegramBotToken string
-	JWTSecret        string
+	JWT              JWTConfig
 	DatabaseURL      string
 	DatabaseConfig   DatabaseConfig
 	CloudinaryConfig CloudinaryConfig
-	AppEnv           string // Добавляем окружение приложения
+	AppEnv           string        // Добавляем окружение приложения
+	ListingTTL       time.Duration // Срок, после которого необновляемое объявление истекает
+
+	TradeConfirmTimeout time.Duration // Срок, за который участники должны подтвердить принятый обмен
+	TradeTTL            time.Duration // Срок, после которого ожидающее предложение истекает
+	TradeReminderBefore time.Duration // За сколько до истечения напомнить получателю о предложении
+
+	AccessTokenTTL  time.Duration // Срок действия access-токена
+	RefreshTokenTTL time.Duration // Срок действия refresh-токена и неактивной сессии
+
+	WSAllowedOrigins []string // Источники, с которых разрешено подключение к WebSocket, кроме своего
+}
+
+// JWTConfig содержит настройки подписи и проверки JWT
+type JWTConfig struct {
+	Algorithm        string               // Алгоритм подписи новых токенов: HS256, RS256 или EdDSA
+	KeyID            string               // kid ключа, которым подписываются новые токены
+	Secret           string               // Секрет для HS256
+	PrivateKeyFile   string               // PEM-файл закрытого ключа для RS256 и EdDSA
+	VerificationKeys []JWTVerificationKey // Предыдущие ключи, токены которых еще принимаются
+	Issuer           string
+	Audience         string
+}
+
+// JWTVerificationKey описывает ключ, который используется только для проверки токенов
+type JWTVerificationKey struct {
+	KeyID     string
+	Algorithm string
+	Secret    string // Секрет для HS256
+	KeyFile   string // PEM-файл открытого ключа для RS256 и EdDSA
 }
 
 // DatabaseConfig содержит конфигурацию базы данных
@@ -65,20 +97,55 @@ func LoadConfig() *Config {
 
 	cfg := &Config{
 		TelegramBotToken: getEnv("TELEGRAM_BOT_TOKEN", ""),
-		JWTSecret:        getEnv("JWT_SECRET", ""),
+		JWT: JWTConfig{
+			Algorithm:        getEnv("JWT_ALGORITHM", "HS256"),
+			KeyID:            getEnv("JWT_KEY_ID", "primary"),
+			Secret:           getEnv("JWT_SECRET", ""),
+			PrivateKeyFile:   getEnv("JWT_PRIVATE_KEY_FILE", ""),
+			VerificationKeys: parseJWTVerificationKeys(getEnv("JWT_VERIFICATION_KEYS", "")),
+			Issuer:           getEnv("JWT_ISSUER", "flippy-api"),
+			Audience:         getEnv("JWT_AUDIENCE", "flippy-app"),
+		},
 		DatabaseURL:      dbURL,
 		DatabaseConfig:   dbConfig,
 		CloudinaryConfig: cloudinaryConfig,
 		AppEnv:           getEnv("APP_ENV", "production"), // По умолчанию production
+		ListingTTL:       time.Duration(getEnvPositiveInt("LISTING_TTL_DAYS", 90)) * 24 * time.Hour,
+
+		TradeConfirmTimeout: time.Duration(getEnvPositiveInt("TRADE_CONFIRM_TIMEOUT_DAYS", 14)) * 24 * time.Hour,
+		TradeTTL:            time.Duration(getEnvPositiveInt("TRADE_TTL_DAYS", 7)) * 24 * time.Hour,
+		TradeReminderBefore: time.Duration(getEnvPositiveInt("TRADE_REMINDER_BEFORE_HOURS", 24)) * time.Hour,
+
+		AccessTokenTTL:  time.Duration(getEnvPositiveInt("ACCESS_TOKEN_TTL_MINUTES", 15)) * time.Minute,
+		RefreshTokenTTL: time.Duration(getEnvPositiveInt("REFRESH_TOKEN_TTL_DAYS", 30)) * 24 * time.Hour,
+
+		WSAllowedOrigins: getEnvList("WS_ALLOWED_ORIGINS"),
 	}
 
-	if cfg.TelegramBotToken == "" || cfg.JWTSecret == "" {
+	if cfg.TelegramBotToken == "" {
 		log.Fatal("❌ Ошибка: Не заданы обязательные переменные окружения")
 	}
 
+	// Для HS256 нужен секрет, для RS256 и EdDSA - файл закрытого ключа
+	if (cfg.JWT.Algorithm == "HS256" && cfg.JWT.Secret == "") ||
+		(cfg.JWT.Algorithm != "HS256" && cfg.JWT.PrivateKeyFile == "") {
+		log.Fatal("❌ Ошибка: Не задан ключ подписи JWT")
+	}
+
 	return cfg
 }
 
+// getEnvList получает список значений через запятую, пустые значения пропускаются
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnv(key, ""), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 // getEnv получает переменную окружения или использует дефолтное значение
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
@@ -86,3 +153,54 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvInt получает целочисленную переменную окружения или использует дефолтное значение
+func getEnvInt(key string, defaultValue int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("⚠️ Некорректное значение %s=%q, используем %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// parseJWTVerificationKeys разбирает список ключей проверки вида "kid:алгоритм:значение" через запятую.
+// Для HS256 значение - секрет, для RS256 и EdDSA - путь к PEM-файлу открытого ключа
+func parseJWTVerificationKeys(value string) []JWTVerificationKey {
+	var keys []JWTVerificationKey
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+			log.Fatalf("❌ Ошибка: Некорректный ключ в JWT_VERIFICATION_KEYS: ожидается kid:алгоритм:значение")
+		}
+
+		key := JWTVerificationKey{KeyID: parts[0], Algorithm: parts[1]}
+		if key.Algorithm == "HS256" {
+			key.Secret = parts[2]
+		} else {
+			key.KeyFile = parts[2]
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// getEnvPositiveInt получает целочисленную переменную окружения, которая должна быть не меньше 1.
+// Нулевое или отрицательное значение считается ошибкой конфигурации
+func getEnvPositiveInt(key string, defaultValue int) int {
+	value := getEnvInt(key, defaultValue)
+	if value < 1 {
+		log.Fatalf("❌ Ошибка: %s должно быть не меньше 1, получено %d", key, value)
+	}
+	return value
+}
@@ -0,0 +1,297 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/rajivgeraev/flippy-api/internal/models"
+)
+
+// TradeWant описывает желание пользователя получить чужое объявление, доступное для обмена
+type TradeWant struct {
+	UserID    uuid.UUID // Кто хочет получить объявление
+	OwnerID   uuid.UUID // Владелец объявления
+	ListingID uuid.UUID
+	CreatedAt time.Time
+}
+
+// GetTradeWants строит ребра графа обменов по избранному. Учитываются только активные объявления,
+// доступные для обмена и не занятые в открытых круговых обменах, и только пользователи,
+// которым есть что отдать взамен
+func GetTradeWants(ctx context.Context) ([]TradeWant, error) {
+	rows, err := Pool.Query(ctx, `
+		SELECT f.user_id, l.user_id, l.id, f.created_at
+		FROM favorites f
+		JOIN listings l ON l.id = f.listing_id
+		WHERE l.status = 'active' AND l.allow_trade = true AND f.user_id != l.user_id
+		  AND EXISTS (
+		      SELECT 1 FROM listings own
+		      WHERE own.user_id = f.user_id AND own.status = 'active' AND own.allow_trade = true
+		  )
+		  AND NOT EXISTS (
+		      SELECT 1 FROM trade_cycle_participants p
+		      JOIN trade_cycles c ON c.id = p.cycle_id
+		      WHERE p.gives_listing_id = l.id AND c.status IN ('proposed', 'active')
+		  )
+		ORDER BY f.created_at DESC
+	`)
+
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении избранного для обменов: %w", err)
+	}
+	defer rows.Close()
+
+	var wants []TradeWant
+	for rows.Next() {
+		var want TradeWant
+		if err := rows.Scan(&want.UserID, &want.OwnerID, &want.ListingID, &want.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании избранного: %w", err)
+		}
+		wants = append(wants, want)
+	}
+
+	return wants, rows.Err()
+}
+
+// CreateTradeCycle сохраняет предложенный круговой обмен.
+// Возвращает false, если такой же набор объявлений уже предложен
+func CreateTradeCycle(ctx context.Context, participants []models.TradeCycleParticipant) (uuid.UUID, bool, error) {
+	listingIDs := make([]string, 0, len(participants))
+	for _, p := range participants {
+		listingIDs = append(listingIDs, p.GivesListingID.String())
+	}
+	sort.Strings(listingIDs)
+
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		return uuid.Nil, false, fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	cycleID := uuid.New()
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO trade_cycles (id, status, signature)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (signature) WHERE status IN ('proposed', 'active') DO NOTHING
+	`, cycleID, models.TradeCycleStatusProposed, strings.Join(listingIDs, ","))
+
+	if err != nil {
+		return uuid.Nil, false, fmt.Errorf("ошибка при создании кругового обмена: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return uuid.Nil, false, nil
+	}
+
+	for _, p := range participants {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO trade_cycle_participants (cycle_id, user_id, position, gives_listing_id, receives_listing_id)
+			VALUES ($1, $2, $3, $4, $5)
+		`, cycleID, p.UserID, p.Position, p.GivesListingID, p.ReceivesListingID)
+
+		if err != nil {
+			return uuid.Nil, false, fmt.Errorf("ошибка при добавлении участника кругового обмена: %w", err)
+		}
+	}
+
+	if err := RecordTradeCycleEvent(ctx, tx, cycleID, models.TradeEventCreated, nil, nil); err != nil {
+		return uuid.Nil, false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return uuid.Nil, false, fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+	}
+
+	return cycleID, true, nil
+}
+
+// GetTradeCycleParticipants получает участников сразу нескольких круговых обменов в порядке цикла
+func GetTradeCycleParticipants(ctx context.Context, cycleIDs []uuid.UUID) (map[uuid.UUID][]models.TradeCycleParticipant, error) {
+	participants := make(map[uuid.UUID][]models.TradeCycleParticipant, len(cycleIDs))
+	if len(cycleIDs) == 0 {
+		return participants, nil
+	}
+
+	rows, err := Pool.Query(ctx, `
+		SELECT cycle_id, user_id, position, gives_listing_id, receives_listing_id, accepted_at, confirmed_at, chat_id
+		FROM trade_cycle_participants
+		WHERE cycle_id = ANY($1)
+		ORDER BY cycle_id, position
+	`, cycleIDs)
+
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении участников кругового обмена: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cycleID uuid.UUID
+		var p models.TradeCycleParticipant
+		if err := rows.Scan(&cycleID, &p.UserID, &p.Position, &p.GivesListingID, &p.ReceivesListingID, &p.AcceptedAt, &p.ConfirmedAt, &p.ChatID); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании участника: %w", err)
+		}
+		participants[cycleID] = append(participants[cycleID], p)
+	}
+
+	return participants, rows.Err()
+}
+
+// CycleActivatedMessage первое сообщение в чате соседних участников активного кругового обмена
+const CycleActivatedMessage = "Круговой обмен принят всеми участниками. Договоритесь здесь о передаче объявления."
+
+// CreateTradeCycleChats создает чат для каждой передачи объявления в активном круговом обмене:
+// между участником и тем, кому он отдает объявление. ID чата сохраняется у отдающего участника
+func CreateTradeCycleChats(ctx context.Context, tx pgx.Tx, cycleID uuid.UUID) error {
+	rows, err := tx.Query(ctx, `
+		SELECT giver.user_id, taker.user_id
+		FROM trade_cycle_participants giver
+		JOIN trade_cycle_participants taker
+		  ON taker.cycle_id = giver.cycle_id AND taker.receives_listing_id = giver.gives_listing_id
+		WHERE giver.cycle_id = $1 AND giver.chat_id IS NULL
+		ORDER BY giver.position
+	`, cycleID)
+
+	if err != nil {
+		return fmt.Errorf("ошибка при получении участников кругового обмена: %w", err)
+	}
+
+	type transfer struct{ giverID, takerID uuid.UUID }
+	var transfers []transfer
+	for rows.Next() {
+		var t transfer
+		if err := rows.Scan(&t.giverID, &t.takerID); err != nil {
+			rows.Close()
+			return fmt.Errorf("ошибка при сканировании участника: %w", err)
+		}
+		transfers = append(transfers, t)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка при чтении участников кругового обмена: %w", err)
+	}
+
+	for _, t := range transfers {
+		chatID, err := createChat(ctx, tx, nil, &cycleID, t.giverID, t.takerID, CycleActivatedMessage)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE trade_cycle_participants SET chat_id = $1 WHERE cycle_id = $2 AND user_id = $3
+		`, chatID, cycleID, t.giverID)
+
+		if err != nil {
+			return fmt.Errorf("ошибка при сохранении чата участника: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GetOverdueActiveCycles возвращает активные круговые обмены, которые никто из участников
+// не подтвердил за timeout после принятия
+func GetOverdueActiveCycles(timeout time.Duration) ([]uuid.UUID, error) {
+	ctx, cancel := GetContext()
+	defer cancel()
+
+	rows, err := Pool.Query(ctx, `
+		SELECT c.id FROM trade_cycles c
+		WHERE c.status = $1 AND c.activated_at < $2
+		  AND NOT EXISTS (
+		      SELECT 1 FROM trade_cycle_participants p
+		      WHERE p.cycle_id = c.id AND p.confirmed_at IS NOT NULL
+		  )
+		ORDER BY c.activated_at
+		LIMIT $3
+	`, models.TradeCycleStatusActive, time.Now().Add(-timeout), repairBatchSize)
+
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при поиске просроченных круговых обменов: %w", err)
+	}
+	defer rows.Close()
+
+	var cycleIDs []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании кругового обмена: %w", err)
+		}
+		cycleIDs = append(cycleIDs, id)
+	}
+
+	return cycleIDs, rows.Err()
+}
+
+// CancelTradeCyclesWithListing отменяет предложенные круговые обмены с удаляемым объявлением:
+// без него цикл разрывается. Активные обмены сюда не попадают, их объявления зарезервированы
+func CancelTradeCyclesWithListing(ctx context.Context, tx pgx.Tx, listingID, actorID uuid.UUID) error {
+	_, err := tx.Exec(ctx, `
+		WITH canceled AS (
+			UPDATE trade_cycles
+			SET status = $1, updated_at = NOW()
+			WHERE status = $2
+			  AND id IN (
+			      SELECT cycle_id FROM trade_cycle_participants
+			      WHERE gives_listing_id = $3 OR receives_listing_id = $3
+			  )
+			RETURNING id
+		)
+		INSERT INTO trade_events (cycle_id, event_type, actor_id, data, created_at)
+		SELECT id, $4, $5, jsonb_build_object('reason', 'listing_deleted', 'listing_id', $3::uuid), clock_timestamp()
+		FROM canceled
+	`, models.TradeCycleStatusCanceled, models.TradeCycleStatusProposed, listingID, models.TradeEventCanceled, actorID)
+
+	if err != nil {
+		return fmt.Errorf("ошибка при отмене круговых обменов с объявлением: %w", err)
+	}
+
+	return nil
+}
+
+// ExpireTradeCycles закрывает круговые обмены, которые не приняли все участники за ttl.
+// Возвращает участников закрытых обменов, чтобы их оповестить
+func ExpireTradeCycles(ttl time.Duration) (map[uuid.UUID][]models.TradeCycleParticipant, error) {
+	ctx, cancel := GetContext()
+	defer cancel()
+
+	// Событие истечения записывается тем же запросом, что и смена статуса
+	rows, err := Pool.Query(ctx, `
+		WITH expired AS (
+			UPDATE trade_cycles
+			SET status = $1, updated_at = NOW()
+			WHERE status = $2 AND created_at < $3
+			RETURNING id
+		), events AS (
+			INSERT INTO trade_events (cycle_id, event_type, created_at)
+			SELECT id, $4, clock_timestamp() FROM expired
+		)
+		SELECT id FROM expired
+	`, models.TradeCycleStatusExpired, models.TradeCycleStatusProposed, time.Now().Add(-ttl), models.TradeEventExpired)
+
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при истечении круговых обменов: %w", err)
+	}
+
+	var cycleIDs []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка при сканировании кругового обмена: %w", err)
+		}
+		cycleIDs = append(cycleIDs, id)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при чтении круговых обменов: %w", err)
+	}
+
+	return GetTradeCycleParticipants(ctx, cycleIDs)
+}
@@ -0,0 +1,224 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/rajivgeraev/flippy-api/internal/models"
+)
+
+// GetListingImages получает изображения сразу для нескольких объявлений одним запросом
+func GetListingImages(ctx context.Context, listingIDs []uuid.UUID) (map[uuid.UUID][]models.ListingImage, error) {
+	images := make(map[uuid.UUID][]models.ListingImage, len(listingIDs))
+	if len(listingIDs) == 0 {
+		return images, nil
+	}
+
+	rows, err := Pool.Query(ctx, `
+		SELECT id, listing_id, url, COALESCE(preview_url, ''), public_id, COALESCE(file_name, ''),
+		       is_main, position, metadata, created_at
+		FROM listing_images
+		WHERE listing_id = ANY($1)
+		ORDER BY listing_id, position ASC
+	`, listingIDs)
+
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении изображений: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var img models.ListingImage
+		var metadataBytes []byte
+
+		if err := rows.Scan(
+			&img.ID,
+			&img.ListingID,
+			&img.URL,
+			&img.PreviewURL,
+			&img.PublicID,
+			&img.FileName,
+			&img.IsMain,
+			&img.Position,
+			&metadataBytes,
+			&img.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании изображения: %w", err)
+		}
+
+		// Преобразуем метаданные из JSON, если они есть
+		if metadataBytes != nil {
+			if err := json.Unmarshal(metadataBytes, &img.Metadata); err != nil {
+				log.Printf("Ошибка разбора метаданных: %v", err)
+			}
+		}
+
+		images[img.ListingID] = append(images[img.ListingID], img)
+	}
+
+	return images, rows.Err()
+}
+
+// AttachListingDetails загружает изображения и владельцев для страницы объявлений.
+// Количество запросов не зависит от размера страницы
+func AttachListingDetails(ctx context.Context, listings []models.Listing) error {
+	if len(listings) == 0 {
+		return nil
+	}
+
+	listingIDs := make([]uuid.UUID, 0, len(listings))
+	userIDs := make([]uuid.UUID, 0, len(listings))
+	for _, listing := range listings {
+		listingIDs = append(listingIDs, listing.ID)
+		userIDs = append(userIDs, listing.UserID)
+	}
+
+	images, err := GetListingImages(ctx, listingIDs)
+	if err != nil {
+		return err
+	}
+
+	users, err := GetUsersInfo(ctx, userIDs)
+	if err != nil {
+		return err
+	}
+
+	for i := range listings {
+		listings[i].Images = images[listings[i].ID]
+		listings[i].User = users[listings[i].UserID]
+	}
+
+	return nil
+}
+
+// GetListingsByIDs получает объявления вместе с изображениями по списку ID
+func GetListingsByIDs(ctx context.Context, listingIDs []uuid.UUID) (map[uuid.UUID]*models.Listing, error) {
+	listings := make(map[uuid.UUID]*models.Listing, len(listingIDs))
+	if len(listingIDs) == 0 {
+		return listings, nil
+	}
+
+	rows, err := Pool.Query(ctx, `
+		SELECT id, user_id, title, description, categories, condition, allow_trade, status
+		FROM listings
+		WHERE id = ANY($1)
+	`, listingIDs)
+
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении объявлений: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var listing models.Listing
+		var categoriesData []byte
+
+		if err := rows.Scan(
+			&listing.ID,
+			&listing.UserID,
+			&listing.Title,
+			&listing.Description,
+			&categoriesData,
+			&listing.Condition,
+			&listing.AllowTrade,
+			&listing.Status,
+		); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании объявления: %w", err)
+		}
+
+		// Преобразуем JSONB категории в массив строк
+		if err := json.Unmarshal(categoriesData, &listing.Categories); err != nil {
+			log.Printf("Ошибка разбора категорий: %v", err)
+			listing.Categories = []string{}
+		}
+
+		listings[listing.ID] = &listing
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при чтении объявлений: %w", err)
+	}
+
+	images, err := GetListingImages(ctx, listingIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	for id, listing := range listings {
+		listing.Images = images[id]
+	}
+
+	return listings, nil
+}
+
+// SetListingsStatus переводит объявления в новый статус внутри транзакции.
+// Строки блокируются в порядке ID, чтобы параллельные транзакции не взаимоблокировались.
+// Если хотя бы один переход недопустим, ни одно объявление не меняется
+func SetListingsStatus(ctx context.Context, tx pgx.Tx, listingIDs []uuid.UUID, status string) error {
+	rows, err := tx.Query(ctx, `
+		SELECT id, status FROM listings WHERE id = ANY($1) ORDER BY id FOR UPDATE
+	`, listingIDs)
+
+	if err != nil {
+		return fmt.Errorf("ошибка при блокировке объявлений: %w", err)
+	}
+
+	found := 0
+	for rows.Next() {
+		var listingID uuid.UUID
+		var current string
+		if err := rows.Scan(&listingID, &current); err != nil {
+			rows.Close()
+			return fmt.Errorf("ошибка при сканировании объявления: %w", err)
+		}
+		found++
+
+		if err := models.ValidateListingTransition(current, status); err != nil {
+			rows.Close()
+			return fmt.Errorf("объявление %s: %w", listingID, err)
+		}
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка при чтении объявлений: %w", err)
+	}
+
+	if found != len(listingIDs) {
+		return pgx.ErrNoRows
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE listings SET status = $1, updated_at = NOW() WHERE id = ANY($2)
+	`, status, listingIDs)
+
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении статуса объявлений: %w", err)
+	}
+
+	return nil
+}
+
+// ExpireStaleListings переводит в статус expired активные объявления, не обновлявшиеся дольше ttl
+func ExpireStaleListings(ttl time.Duration) (int64, error) {
+	ctx, cancel := GetContext()
+	defer cancel()
+
+	tag, err := Pool.Exec(ctx, `
+		UPDATE listings
+		SET status = $1, updated_at = NOW()
+		WHERE status = $2 AND updated_at < $3
+	`, models.ListingStatusExpired, models.ListingStatusActive, time.Now().Add(-ttl))
+
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при истечении срока объявлений: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/rajivgeraev/flippy-api/internal/models"
+)
+
+// GetNotifications возвращает уведомления пользователя, начиная с новых.
+// Если unreadOnly, возвращаются только непрочитанные
+func GetNotifications(ctx context.Context, userID uuid.UUID, unreadOnly bool, limit int) ([]models.Notification, error) {
+	rows, err := Pool.Query(ctx, `
+		SELECT id, type, payload, created_at, read_at
+		FROM notifications
+		WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3
+	`, userID, unreadOnly, limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении уведомлений: %w", err)
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		var notification models.Notification
+		var payload []byte
+		if err := rows.Scan(&notification.ID, &notification.Type, &payload, &notification.CreatedAt, &notification.ReadAt); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании уведомления: %w", err)
+		}
+		notification.Payload = payload
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, rows.Err()
+}
+
+// CountUnreadNotifications возвращает количество непрочитанных уведомлений пользователя
+func CountUnreadNotifications(ctx context.Context, userID uuid.UUID) (int, error) {
+	var count int
+	err := Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL
+	`, userID).Scan(&count)
+
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при подсчете уведомлений: %w", err)
+	}
+
+	return count, nil
+}
+
+// MarkNotificationsRead отмечает уведомления пользователя прочитанными.
+// Если ids пустой, отмечаются все непрочитанные уведомления
+func MarkNotificationsRead(ctx context.Context, userID uuid.UUID, ids []uuid.UUID) (int64, error) {
+	tag, err := Pool.Exec(ctx, `
+		UPDATE notifications SET read_at = NOW()
+		WHERE user_id = $1 AND read_at IS NULL AND (COALESCE(cardinality($2::uuid[]), 0) = 0 OR id = ANY($2))
+	`, userID, ids)
+
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при отметке уведомлений: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/rajivgeraev/flippy-api/internal/models"
+)
+
+// ProfileUpdate содержит изменяемые поля профиля. nil означает, что поле не меняется,
+// пустая строка очищает поле
+type ProfileUpdate struct {
+	Username  *string
+	FirstName *string
+	LastName  *string
+	Email     *string
+	Phone     *string
+	Bio       *string
+	AvatarURL *string
+	Location  *string
+}
+
+// UpdateUserProfile обновляет профиль пользователя и записывает изменение в историю.
+// Возвращает false, если значения не изменились, и pgx.ErrNoRows, если пользователь не найден.
+// Нарушение уникальности username или email возвращается как ошибка PostgreSQL
+func UpdateUserProfile(ctx context.Context, userID uuid.UUID, update ProfileUpdate) (bool, error) {
+	args := []interface{}{userID}
+	var sets, changes []string
+
+	for _, field := range []struct {
+		column string
+		value  *string
+	}{
+		{"username", update.Username},
+		{"first_name", update.FirstName},
+		{"last_name", update.LastName},
+		{"email", update.Email},
+		{"phone", update.Phone},
+		{"bio", update.Bio},
+		{"avatar_url", update.AvatarURL},
+		{"location", update.Location},
+	} {
+		if field.value == nil {
+			continue
+		}
+		args = append(args, *field.value)
+		sets = append(sets, fmt.Sprintf("%s = NULLIF($%d, '')", field.column, len(args)))
+		changes = append(changes, fmt.Sprintf("%s IS DISTINCT FROM NULLIF($%d, '')", field.column, len(args)))
+	}
+
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	updated := false
+	if len(sets) > 0 {
+		// Запись без фактических изменений не обновляется и не попадает в историю
+		tag, err := tx.Exec(ctx, fmt.Sprintf(`
+			UPDATE users SET %s, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1 AND (%s)
+		`, strings.Join(sets, ", "), strings.Join(changes, " OR ")), args...)
+
+		if err != nil {
+			return false, fmt.Errorf("ошибка при обновлении профиля: %w", err)
+		}
+		updated = tag.RowsAffected() > 0
+	}
+
+	if !updated {
+		var exists bool
+		if err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists); err != nil {
+			return false, fmt.Errorf("ошибка при проверке пользователя: %w", err)
+		}
+		if !exists {
+			return false, pgx.ErrNoRows
+		}
+		return false, nil
+	}
+
+	if err = addToUserHistory(ctx, tx, userID, "users", userID); err != nil {
+		return false, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+	}
+
+	return true, nil
+}
+
+// GetUserTradeStats возвращает статистику обменов пользователя
+func GetUserTradeStats(ctx context.Context, userID uuid.UUID) (models.TradeStats, error) {
+	var stats models.TradeStats
+	err := Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FILTER (WHERE status = 'completed'),
+		       COUNT(*) FILTER (WHERE status = 'accepted'),
+		       MAX(completed_at)
+		FROM trades
+		WHERE (sender_id = $1 OR receiver_id = $1) AND status IN ('accepted', 'completed')
+	`, userID).Scan(&stats.Completed, &stats.Active, &stats.LastCompletedAt)
+
+	if err != nil {
+		return stats, fmt.Errorf("ошибка при получении статистики обменов: %w", err)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/rajivgeraev/flippy-api/internal/models"
+)
+
+// reputationJoinSQL присоединяет к запросу по users u агрегаты отзывов о пользователе как rep
+const reputationJoinSQL = `LEFT JOIN LATERAL (
+		SELECT COUNT(*)::int AS count,
+		       COALESCE(round(AVG(rating), 2), 0)::float8 AS average,
+		       round(AVG(rating) FILTER (WHERE created_at > NOW() - INTERVAL '90 days'), 2)::float8 AS recent_average
+		FROM reviews
+		WHERE reviewee_id = u.id
+	) rep ON true`
+
+// GetUserReputation вычисляет репутацию пользователя по отзывам о нем
+func GetUserReputation(ctx context.Context, userID uuid.UUID) (*models.Reputation, error) {
+	var count int
+	var average float64
+	var recentAverage *float64
+
+	err := Pool.QueryRow(ctx, `
+		SELECT rep.count, rep.average, rep.recent_average
+		FROM users u
+		`+reputationJoinSQL+`
+		WHERE u.id = $1
+	`, userID).Scan(&count, &average, &recentAverage)
+
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при вычислении репутации: %w", err)
+	}
+
+	return models.NewReputation(count, average, recentAverage), nil
+}
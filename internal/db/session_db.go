@@ -0,0 +1,182 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/rajivgeraev/flippy-api/internal/models"
+)
+
+// CreateSession создает сессию пользователя при входе и сохраняет хеш refresh-токена
+func CreateSession(ctx context.Context, userID uuid.UUID, deviceInfo, ipAddress, refreshTokenHash string, refreshExpiresAt time.Time) (uuid.UUID, error) {
+	var sessionID uuid.UUID
+	err := Pool.QueryRow(ctx, `
+		INSERT INTO user_sessions (user_id, device_info, ip_address, refresh_token_hash, refresh_expires_at)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5)
+		RETURNING id
+	`, userID, deviceInfo, ipAddress, refreshTokenHash, refreshExpiresAt).Scan(&sessionID)
+
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("ошибка при создании сессии: %w", err)
+	}
+
+	return sessionID, nil
+}
+
+// RotateRefreshToken заменяет refresh-токен сессии на новый и возвращает сессию.
+// Если предъявлен уже замененный токен, сессия отзывается и возвращается вместе с ErrRefreshTokenReused,
+// чтобы вызывающий мог закрыть ее соединения
+func RotateRefreshToken(ctx context.Context, refreshTokenHash, newRefreshTokenHash string, refreshExpiresAt time.Time) (*models.Session, error) {
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var session models.Session
+	var expiresAt *time.Time
+	err = tx.QueryRow(ctx, `
+		SELECT id, user_id, logout_time, refresh_expires_at
+		FROM user_sessions
+		WHERE refresh_token_hash = $1
+		FOR UPDATE
+	`, refreshTokenHash).Scan(&session.ID, &session.UserID, &session.LogoutTime, &expiresAt)
+
+	if err == pgx.ErrNoRows {
+		// Токен мог быть уже заменен: тогда им пользуется кто-то еще, и сессию нужно отозвать
+		err := tx.QueryRow(ctx, `
+			UPDATE user_sessions SET logout_time = NOW()
+			WHERE previous_refresh_token_hash = $1 AND logout_time IS NULL
+			RETURNING id, user_id
+		`, refreshTokenHash).Scan(&session.ID, &session.UserID)
+		if err == pgx.ErrNoRows {
+			return nil, models.ErrSessionNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при отзыве сессии: %w", err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return nil, fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+		}
+		return &session, models.ErrRefreshTokenReused
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении сессии: %w", err)
+	}
+
+	if session.LogoutTime != nil || expiresAt == nil || expiresAt.Before(time.Now()) {
+		return nil, models.ErrSessionNotFound
+	}
+
+	err = tx.QueryRow(ctx, `
+		UPDATE user_sessions
+		SET previous_refresh_token_hash = refresh_token_hash, refresh_token_hash = $2,
+		    refresh_expires_at = $3, last_active = NOW()
+		WHERE id = $1
+		RETURNING refresh_expires_at, last_active
+	`, session.ID, newRefreshTokenHash, refreshExpiresAt).Scan(&session.RefreshExpiresAt, &session.LastActive)
+
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при обновлении сессии: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+	}
+
+	return &session, nil
+}
+
+// TouchSession проверяет, что сессия принадлежит пользователю и не отозвана, и обновляет last_active.
+// Чтобы не писать в базу на каждый запрос, last_active обновляется не чаще раза в minInterval,
+// причем тем же запросом, что и проверка. Возвращает текущую роль пользователя из базы,
+// чтобы смена роли действовала сразу, а не после перевыпуска токена.
+// Для отозванной или чужой сессии возвращается пустая строка
+func TouchSession(ctx context.Context, sessionID, userID uuid.UUID, minInterval time.Duration) (string, error) {
+	var role string
+	err := Pool.QueryRow(ctx, `
+		WITH session AS (
+		    SELECT s.id, s.last_active, u.role FROM user_sessions s
+		    JOIN users u ON u.id = s.user_id
+		    WHERE s.id = $1 AND s.user_id = $2 AND s.logout_time IS NULL AND s.refresh_expires_at > NOW()
+		), touched AS (
+		    UPDATE user_sessions SET last_active = NOW()
+		    WHERE id IN (SELECT id FROM session WHERE last_active IS NULL OR last_active < $3)
+		)
+		SELECT role FROM session
+	`, sessionID, userID, time.Now().Add(-minInterval)).Scan(&role)
+
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("ошибка при проверке сессии: %w", err)
+	}
+
+	return role, nil
+}
+
+// GetActiveSessions возвращает неотозванные сессии пользователя, начиная с последней активной
+func GetActiveSessions(ctx context.Context, userID uuid.UUID) ([]models.Session, error) {
+	rows, err := Pool.Query(ctx, `
+		SELECT id, user_id, COALESCE(device_info, ''), COALESCE(ip_address, ''),
+		       login_time, COALESCE(last_active, login_time), refresh_expires_at
+		FROM user_sessions
+		WHERE user_id = $1 AND logout_time IS NULL AND refresh_expires_at > NOW()
+		ORDER BY last_active DESC NULLS LAST, id
+	`, userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении сессий: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		if err := rows.Scan(&session.ID, &session.UserID, &session.DeviceInfo, &session.IPAddress,
+			&session.LoginTime, &session.LastActive, &session.RefreshExpiresAt); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании сессии: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// RevokeSession отзывает сессию пользователя. Возвращает ErrSessionNotFound,
+// если сессия не найдена или уже отозвана
+func RevokeSession(ctx context.Context, sessionID, userID uuid.UUID) error {
+	tag, err := Pool.Exec(ctx, `
+		UPDATE user_sessions SET logout_time = NOW()
+		WHERE id = $1 AND user_id = $2 AND logout_time IS NULL
+	`, sessionID, userID)
+
+	if err != nil {
+		return fmt.Errorf("ошибка при отзыве сессии: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return models.ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// RevokeOtherSessions отзывает все сессии пользователя, кроме текущей, и возвращает их количество
+func RevokeOtherSessions(ctx context.Context, userID, currentSessionID uuid.UUID) (int64, error) {
+	tag, err := Pool.Exec(ctx, `
+		UPDATE user_sessions SET logout_time = NOW()
+		WHERE user_id = $1 AND id != $2 AND logout_time IS NULL
+	`, userID, currentSessionID)
+
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при отзыве сессий: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
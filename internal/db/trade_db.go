@@ -0,0 +1,507 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/rajivgeraev/flippy-api/internal/models"
+)
+
+// TradeAcceptedMessage первое сообщение в чате принятого обмена
+const TradeAcceptedMessage = "Обмен был принят. Вы можете обсудить детали здесь."
+
+// repairBatchSize ограничивает количество обменов, восстанавливаемых за один проход
+const repairBatchSize = 100
+
+// CreateTradeChat создает чат принятого обмена вместе с первым сообщением внутри транзакции
+func CreateTradeChat(ctx context.Context, tx pgx.Tx, tradeID, senderID, receiverID uuid.UUID) (uuid.UUID, error) {
+	return createChat(ctx, tx, &tradeID, nil, senderID, receiverID, TradeAcceptedMessage)
+}
+
+// createChat создает чат обычного или кругового обмена и первое сообщение от имени senderID
+func createChat(ctx context.Context, tx pgx.Tx, tradeID, cycleID *uuid.UUID, senderID, receiverID uuid.UUID, text string) (uuid.UUID, error) {
+	chatID := uuid.New()
+	now := time.Now()
+
+	_, err := tx.Exec(ctx, `
+		INSERT INTO chats (id, trade_id, cycle_id, sender_id, receiver_id, created_at, updated_at, last_message_text, last_message_time, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $6, $7, $6, true)
+	`, chatID, tradeID, cycleID, senderID, receiverID, now, text)
+
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("ошибка при создании чата обмена: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO messages (id, chat_id, sender_id, text, is_read, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, false, $5, $5)
+	`, uuid.New(), chatID, senderID, text, now)
+
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("ошибка при создании первого сообщения чата: %w", err)
+	}
+
+	return chatID, nil
+}
+
+// RepairTradeChats создает чаты для принятых обменов, у которых их нет.
+// Такие обмены могли остаться после сбоев, когда чат создавался вне транзакции принятия
+func RepairTradeChats() (int, error) {
+	ctx, cancel := GetContext()
+	defer cancel()
+
+	rows, err := Pool.Query(ctx, `
+		SELECT t.id FROM trades t
+		WHERE t.status IN ('accepted', 'completed')
+		  AND NOT EXISTS (SELECT 1 FROM chats c WHERE c.trade_id = t.id)
+		ORDER BY t.updated_at
+		LIMIT $1
+	`, repairBatchSize)
+
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при поиске обменов без чата: %w", err)
+	}
+
+	var tradeIDs []uuid.UUID
+	for rows.Next() {
+		var tradeID uuid.UUID
+		if err := rows.Scan(&tradeID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("ошибка при сканировании обмена: %w", err)
+		}
+		tradeIDs = append(tradeIDs, tradeID)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("ошибка при чтении обменов без чата: %w", err)
+	}
+
+	repaired := 0
+	for _, tradeID := range tradeIDs {
+		created, err := repairTradeChat(ctx, tradeID)
+		if err != nil {
+			log.Printf("Ошибка восстановления чата обмена %s: %v", tradeID, err)
+			continue
+		}
+		if created {
+			repaired++
+		}
+	}
+
+	return repaired, nil
+}
+
+// repairTradeChat создает чат для одного обмена. Строка обмена блокируется,
+// поэтому параллельные проходы не создадут второй чат
+func repairTradeChat(ctx context.Context, tradeID uuid.UUID) (bool, error) {
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var senderID, receiverID uuid.UUID
+	err = tx.QueryRow(ctx, `
+		SELECT sender_id, receiver_id FROM trades
+		WHERE id = $1 AND status IN ('accepted', 'completed')
+		FOR UPDATE
+	`, tradeID).Scan(&senderID, &receiverID)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	var exists bool
+	err = tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM chats WHERE trade_id = $1)`, tradeID).Scan(&exists)
+	if err != nil || exists {
+		return false, err
+	}
+
+	if _, err := CreateTradeChat(ctx, tx, tradeID, senderID, receiverID); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+// CreateTradeItems сохраняет объявления обеих сторон обмена в порядке, указанном пользователем
+func CreateTradeItems(ctx context.Context, tx pgx.Tx, tradeID uuid.UUID, senderListingIDs, receiverListingIDs []uuid.UUID) error {
+	for side, listingIDs := range map[string][]uuid.UUID{
+		models.TradeSideSender:   senderListingIDs,
+		models.TradeSideReceiver: receiverListingIDs,
+	} {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO trade_items (trade_id, listing_id, side, position)
+			SELECT $1, item.listing_id, $2, item.position - 1
+			FROM unnest($3::uuid[]) WITH ORDINALITY AS item(listing_id, position)
+		`, tradeID, side, listingIDs)
+
+		if err != nil {
+			return fmt.Errorf("ошибка при сохранении объявлений обмена: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GetTradeListingIDs возвращает объявления отправителя и получателя обмена внутри транзакции
+func GetTradeListingIDs(ctx context.Context, tx pgx.Tx, tradeID uuid.UUID) ([]uuid.UUID, []uuid.UUID, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT listing_id, side FROM trade_items
+		WHERE trade_id = $1 AND listing_id IS NOT NULL
+		ORDER BY position
+	`, tradeID)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка при получении объявлений обмена: %w", err)
+	}
+	defer rows.Close()
+
+	var senderListingIDs, receiverListingIDs []uuid.UUID
+	for rows.Next() {
+		var listingID uuid.UUID
+		var side string
+		if err := rows.Scan(&listingID, &side); err != nil {
+			return nil, nil, fmt.Errorf("ошибка при сканировании объявления обмена: %w", err)
+		}
+
+		if side == models.TradeSideSender {
+			senderListingIDs = append(senderListingIDs, listingID)
+		} else {
+			receiverListingIDs = append(receiverListingIDs, listingID)
+		}
+	}
+
+	return senderListingIDs, receiverListingIDs, rows.Err()
+}
+
+// PendingTradeExists проверяет, есть ли у отправителя ожидающее предложение с тем же набором объявлений
+func PendingTradeExists(ctx context.Context, tx pgx.Tx, senderID uuid.UUID, senderListingIDs, receiverListingIDs []uuid.UUID) (bool, error) {
+	var exists bool
+	err := tx.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM trades t
+			WHERE t.sender_id = $1 AND t.status = 'pending'
+			  AND ARRAY(SELECT listing_id FROM trade_items
+			            WHERE trade_id = t.id AND side = 'sender' ORDER BY listing_id) = $2::uuid[]
+			  AND ARRAY(SELECT listing_id FROM trade_items
+			            WHERE trade_id = t.id AND side = 'receiver' ORDER BY listing_id) = $3::uuid[]
+		)
+	`, senderID, sortedIDs(senderListingIDs), sortedIDs(receiverListingIDs)).Scan(&exists)
+
+	if err != nil {
+		return false, fmt.Errorf("ошибка при проверке существующих предложений: %w", err)
+	}
+
+	return exists, nil
+}
+
+// AttachTradeDetails загружает объявления и участников для страницы обменов.
+// Количество запросов не зависит от размера страницы
+func AttachTradeDetails(ctx context.Context, trades []models.Trade) error {
+	if len(trades) == 0 {
+		return nil
+	}
+
+	tradeIDs := make([]uuid.UUID, 0, len(trades))
+	userIDs := make([]uuid.UUID, 0, len(trades)*2)
+	for _, trade := range trades {
+		tradeIDs = append(tradeIDs, trade.ID)
+		userIDs = append(userIDs, trade.SenderID, trade.ReceiverID)
+	}
+
+	rows, err := Pool.Query(ctx, `
+		SELECT trade_id, listing_id, side FROM trade_items
+		WHERE trade_id = ANY($1) AND listing_id IS NOT NULL
+		ORDER BY trade_id, position
+	`, tradeIDs)
+
+	if err != nil {
+		return fmt.Errorf("ошибка при получении объявлений обменов: %w", err)
+	}
+
+	type tradeSides struct {
+		sender   []uuid.UUID
+		receiver []uuid.UUID
+	}
+
+	items := make(map[uuid.UUID]*tradeSides, len(trades))
+	var listingIDs []uuid.UUID
+	for rows.Next() {
+		var tradeID, listingID uuid.UUID
+		var side string
+		if err := rows.Scan(&tradeID, &listingID, &side); err != nil {
+			rows.Close()
+			return fmt.Errorf("ошибка при сканировании объявления обмена: %w", err)
+		}
+
+		sides := items[tradeID]
+		if sides == nil {
+			sides = &tradeSides{}
+			items[tradeID] = sides
+		}
+
+		if side == models.TradeSideSender {
+			sides.sender = append(sides.sender, listingID)
+		} else {
+			sides.receiver = append(sides.receiver, listingID)
+		}
+		listingIDs = append(listingIDs, listingID)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка при чтении объявлений обменов: %w", err)
+	}
+
+	listings, err := GetListingsByIDs(ctx, listingIDs)
+	if err != nil {
+		return err
+	}
+
+	users, err := GetUsersInfo(ctx, userIDs)
+	if err != nil {
+		return err
+	}
+
+	for i := range trades {
+		trade := &trades[i]
+		trade.Sender = users[trade.SenderID]
+		trade.Receiver = users[trade.ReceiverID]
+
+		sides := items[trade.ID]
+		if sides == nil {
+			continue
+		}
+
+		trade.SenderListingIDs = sides.sender
+		trade.ReceiverListingIDs = sides.receiver
+		trade.SenderListings = PickListings(listings, sides.sender)
+		trade.ReceiverListings = PickListings(listings, sides.receiver)
+		if trade.SenderListingID != nil {
+			trade.SenderListing = listings[*trade.SenderListingID]
+		}
+		if trade.ReceiverListingID != nil {
+			trade.ReceiverListing = listings[*trade.ReceiverListingID]
+		}
+	}
+
+	return nil
+}
+
+// PickListings возвращает объявления в порядке listingIDs, пропуская удаленные
+func PickListings(listings map[uuid.UUID]*models.Listing, listingIDs []uuid.UUID) []*models.Listing {
+	result := make([]*models.Listing, 0, len(listingIDs))
+	for _, id := range listingIDs {
+		if listing, ok := listings[id]; ok {
+			result = append(result, listing)
+		}
+	}
+	return result
+}
+
+// sortedIDs возвращает отсортированную копию ID в том же порядке, в котором их сравнивает PostgreSQL
+func sortedIDs(ids []uuid.UUID) []uuid.UUID {
+	sorted := append([]uuid.UUID(nil), ids...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i][:], sorted[j][:]) < 0
+	})
+	return sorted
+}
+
+// FlagOverdueTrades отмечает принятые обмены, которые участники не подтвердили за timeout.
+// Возвращает отмеченные обмены, чтобы оповестить участников
+func FlagOverdueTrades(timeout time.Duration) ([]models.Trade, error) {
+	ctx, cancel := GetContext()
+	defer cancel()
+
+	rows, err := Pool.Query(ctx, `
+		UPDATE trades
+		SET confirmation_overdue_at = NOW()
+		WHERE status = 'accepted' AND confirmation_overdue_at IS NULL AND accepted_at < $1
+		RETURNING id, sender_id, receiver_id, sender_confirmed_at, receiver_confirmed_at
+	`, time.Now().Add(-timeout))
+
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при отметке просроченных обменов: %w", err)
+	}
+	defer rows.Close()
+
+	var trades []models.Trade
+	for rows.Next() {
+		var trade models.Trade
+		if err := rows.Scan(&trade.ID, &trade.SenderID, &trade.ReceiverID, &trade.SenderConfirmedAt, &trade.ReceiverConfirmedAt); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании обмена: %w", err)
+		}
+		trades = append(trades, trade)
+	}
+
+	return trades, rows.Err()
+}
+
+// GetAbandonedTrades возвращает принятые обмены, которые ни одна сторона не подтвердила
+// даже спустя timeout после напоминания
+func GetAbandonedTrades(timeout time.Duration) ([]models.Trade, error) {
+	ctx, cancel := GetContext()
+	defer cancel()
+
+	rows, err := Pool.Query(ctx, `
+		SELECT id, sender_id, receiver_id
+		FROM trades
+		WHERE status = 'accepted' AND confirmation_overdue_at < $1
+		  AND sender_confirmed_at IS NULL AND receiver_confirmed_at IS NULL
+		ORDER BY confirmation_overdue_at
+		LIMIT $2
+	`, time.Now().Add(-timeout), repairBatchSize)
+
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при поиске брошенных обменов: %w", err)
+	}
+	defer rows.Close()
+
+	var trades []models.Trade
+	for rows.Next() {
+		var trade models.Trade
+		if err := rows.Scan(&trade.ID, &trade.SenderID, &trade.ReceiverID); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании обмена: %w", err)
+		}
+		trades = append(trades, trade)
+	}
+
+	return trades, rows.Err()
+}
+
+// ExpirePendingTrades переводит в статус expired ожидающие предложения старше ttl.
+// Возвращает истекшие предложения, чтобы оповестить участников
+func ExpirePendingTrades(ttl time.Duration, reason string) ([]models.Trade, error) {
+	ctx, cancel := GetContext()
+	defer cancel()
+
+	// Событие в истории и уведомления обеим сторонам записываются тем же запросом, что и смена статуса,
+	// поэтому участники не в сети узнают об истечении при следующем входе
+	rows, err := Pool.Query(ctx, `
+		WITH expired AS (
+			UPDATE trades
+			SET status = 'expired', updated_at = NOW()
+			WHERE status = 'pending' AND created_at < $1
+			RETURNING id, sender_id, receiver_id
+		), events AS (
+			INSERT INTO trade_events (trade_id, event_type)
+			SELECT id, 'expired' FROM expired
+		), notified AS (
+			INSERT INTO notifications (user_id, type, payload)
+			SELECT participant, $2, jsonb_build_object('trade_id', id, 'status', 'expired', 'reason', $3::text)
+			FROM expired, LATERAL (VALUES (sender_id), (receiver_id)) p(participant)
+		)
+		SELECT id, sender_id, receiver_id FROM expired
+	`, time.Now().Add(-ttl), models.NotificationTradeUpdated, reason)
+
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при истечении срока предложений: %w", err)
+	}
+	defer rows.Close()
+
+	var trades []models.Trade
+	for rows.Next() {
+		var trade models.Trade
+		if err := rows.Scan(&trade.ID, &trade.SenderID, &trade.ReceiverID); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании предложения: %w", err)
+		}
+		trades = append(trades, trade)
+	}
+
+	return trades, rows.Err()
+}
+
+// CancelTradesWithListing отменяет ожидающие предложения, в которых участвует удаляемое объявление,
+// чтобы они не поменяли состав молча. В истории каждого предложения записывается отмена
+// от имени владельца объявления, а второй участник получает уведомление
+func CancelTradesWithListing(ctx context.Context, tx pgx.Tx, listingID, actorID uuid.UUID, reason string) ([]models.Trade, error) {
+	rows, err := tx.Query(ctx, `
+		WITH canceled AS (
+			UPDATE trades
+			SET status = 'canceled', updated_at = NOW()
+			WHERE status = 'pending'
+			  AND id IN (SELECT trade_id FROM trade_items WHERE listing_id = $1)
+			RETURNING id, sender_id, receiver_id
+		), events AS (
+			INSERT INTO trade_events (trade_id, event_type, actor_id, data, created_at)
+			SELECT id, 'canceled', $2, jsonb_build_object('reason', 'listing_deleted', 'listing_id', $1::uuid), clock_timestamp()
+			FROM canceled
+		), notified AS (
+			INSERT INTO notifications (user_id, type, payload)
+			SELECT CASE WHEN sender_id = $2 THEN receiver_id ELSE sender_id END, $3,
+			       jsonb_build_object('trade_id', id, 'status', 'canceled', 'reason', $4::text)
+			FROM canceled
+		)
+		SELECT id, sender_id, receiver_id FROM canceled
+	`, listingID, actorID, models.NotificationTradeUpdated, reason)
+
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при отмене предложений с объявлением: %w", err)
+	}
+	defer rows.Close()
+
+	var trades []models.Trade
+	for rows.Next() {
+		var trade models.Trade
+		if err := rows.Scan(&trade.ID, &trade.SenderID, &trade.ReceiverID); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании предложения: %w", err)
+		}
+		trades = append(trades, trade)
+	}
+
+	return trades, rows.Err()
+}
+
+// MarkTradesForReminder отмечает ожидающие предложения, которые истекут в течение remindBefore,
+// и возвращает их для отправки напоминания. Каждое предложение возвращается только один раз.
+// Напоминание сохраняется в уведомлениях получателя тем же запросом, поэтому отметка
+// не теряет напоминание, если получатель не в сети
+func MarkTradesForReminder(ttl, remindBefore time.Duration) ([]models.Trade, error) {
+	ctx, cancel := GetContext()
+	defer cancel()
+
+	now := time.Now()
+	rows, err := Pool.Query(ctx, `
+		WITH reminded AS (
+			UPDATE trades
+			SET reminder_sent_at = NOW()
+			WHERE status = 'pending' AND reminder_sent_at IS NULL
+			  AND created_at < $1 AND created_at >= $2
+			RETURNING id, sender_id, receiver_id, created_at
+		), notified AS (
+			INSERT INTO notifications (user_id, type, payload)
+			SELECT receiver_id, $3, jsonb_build_object('trade_id', id, 'expires_at', created_at + make_interval(secs => $4))
+			FROM reminded
+		)
+		SELECT id, sender_id, receiver_id, created_at FROM reminded
+	`, now.Add(remindBefore-ttl), now.Add(-ttl), models.NotificationTradeReminder, ttl.Seconds())
+
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при отметке предложений для напоминания: %w", err)
+	}
+	defer rows.Close()
+
+	var trades []models.Trade
+	for rows.Next() {
+		var trade models.Trade
+		if err := rows.Scan(&trade.ID, &trade.SenderID, &trade.ReceiverID, &trade.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании предложения: %w", err)
+		}
+		trades = append(trades, trade)
+	}
+
+	return trades, rows.Err()
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/rajivgeraev/flippy-api/internal/models"
+)
+
+// RecordTradeEvent добавляет событие в историю обмена в рамках транзакции, изменившей обмен.
+// actorID равен nil для автоматических событий, data может быть nil
+func RecordTradeEvent(ctx context.Context, tx pgx.Tx, tradeID uuid.UUID, eventType string, actorID *uuid.UUID, data interface{}) error {
+	return RecordTradeEvents(ctx, tx, []uuid.UUID{tradeID}, eventType, actorID, data)
+}
+
+// RecordTradeEvents добавляет одинаковое событие в историю нескольких обменов
+func RecordTradeEvents(ctx context.Context, tx pgx.Tx, tradeIDs []uuid.UUID, eventType string, actorID *uuid.UUID, data interface{}) error {
+	if len(tradeIDs) == 0 {
+		return nil
+	}
+	return recordEvents(ctx, tx, "trade_id", tradeIDs, eventType, actorID, data)
+}
+
+// RecordTradeCycleEvent добавляет событие в историю кругового обмена
+func RecordTradeCycleEvent(ctx context.Context, tx pgx.Tx, cycleID uuid.UUID, eventType string, actorID *uuid.UUID, data interface{}) error {
+	return recordEvents(ctx, tx, "cycle_id", []uuid.UUID{cycleID}, eventType, actorID, data)
+}
+
+// recordEvents сохраняет события для обменов, на которые ссылается столбец subjectColumn
+func recordEvents(ctx context.Context, tx pgx.Tx, subjectColumn string, ids []uuid.UUID, eventType string, actorID *uuid.UUID, data interface{}) error {
+	var payload []byte
+	if data != nil {
+		var err error
+		if payload, err = json.Marshal(data); err != nil {
+			return fmt.Errorf("ошибка при сериализации данных события: %w", err)
+		}
+	}
+
+	// clock_timestamp, а не NOW(): события одной транзакции должны идти в порядке записи
+	_, err := tx.Exec(ctx, fmt.Sprintf(`
+		INSERT INTO trade_events (%s, event_type, actor_id, data, created_at)
+		SELECT unnest($1::uuid[]), $2, $3, $4, clock_timestamp()
+	`, subjectColumn), ids, eventType, actorID, payload)
+
+	if err != nil {
+		return fmt.Errorf("ошибка при сохранении события обмена: %w", err)
+	}
+
+	return nil
+}
+
+// GetTradeEvents возвращает историю обмена в хронологическом порядке
+func GetTradeEvents(ctx context.Context, tradeID uuid.UUID) ([]models.TradeEvent, error) {
+	return getEvents(ctx, "trade_id", tradeID)
+}
+
+// GetTradeCycleEvents возвращает историю кругового обмена в хронологическом порядке
+func GetTradeCycleEvents(ctx context.Context, cycleID uuid.UUID) ([]models.TradeEvent, error) {
+	return getEvents(ctx, "cycle_id", cycleID)
+}
+
+// getEvents загружает события обмена, на который ссылается столбец subjectColumn
+func getEvents(ctx context.Context, subjectColumn string, id uuid.UUID) ([]models.TradeEvent, error) {
+	rows, err := Pool.Query(ctx, fmt.Sprintf(`
+		SELECT id, trade_id, cycle_id, event_type, actor_id, data, created_at
+		FROM trade_events
+		WHERE %s = $1
+		ORDER BY created_at, id
+	`, subjectColumn), id)
+
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении истории обмена: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.TradeEvent{}
+	for rows.Next() {
+		var event models.TradeEvent
+		var data []byte
+		if err := rows.Scan(&event.ID, &event.TradeID, &event.CycleID, &event.Type, &event.ActorID, &data, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании события обмена: %w", err)
+		}
+		event.Data = data
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/rajivgeraev/flippy-api/internal/models"
 )
 
 // User представляет пользователя в системе
@@ -26,6 +28,7 @@ type User struct {
 	UpdatedAt   time.Time
 	LastLoginAt time.Time
 	IsActive    bool
+	Role        string // user, moderator или admin
 }
 
 // TelegramUser представляет данные пользователя из Telegram
@@ -73,13 +76,23 @@ func CreateOrUpdateTelegramUser(telegramID int64, username, firstName, lastName,
 
 	// Если пользователь не существует, создаем нового
 	if err == pgx.ErrNoRows {
-		// Создаем запись в users
+		// Создаем запись в users. Имя из Telegram могли уже занять в профиле другого пользователя:
+		// тогда пользователь создается без имени и сможет выбрать его сам
 		err = tx.QueryRow(ctx, `
 			INSERT INTO users (first_name, last_name, username, avatar_url, last_login_at)
 			VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+			ON CONFLICT ((lower(username))) DO NOTHING
 			RETURNING id
 		`, firstName, lastName, username, photoURL).Scan(&userID)
 
+		if err == pgx.ErrNoRows {
+			err = tx.QueryRow(ctx, `
+				INSERT INTO users (first_name, last_name, avatar_url, last_login_at)
+				VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+				RETURNING id
+			`, firstName, lastName, photoURL).Scan(&userID)
+		}
+
 		if err != nil {
 			return nil, fmt.Errorf("ошибка при создании пользователя: %w", err)
 		}
@@ -232,12 +245,12 @@ func getUserByID(ctx context.Context, tx pgx.Tx, userID uuid.UUID) (*User, error
 
 	err := tx.QueryRow(ctx, `
 		SELECT id, username, first_name, last_name, email, phone, bio, avatar_url, 
-			   location, created_at, updated_at, last_login_at, is_active
+			   location, created_at, updated_at, last_login_at, is_active, role
 		FROM users WHERE id = $1
 	`, userID).Scan(
 		&user.ID, &username, &firstName, &lastName,
 		&email, &phone, &bio, &avatarURL,
-		&location, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt, &user.IsActive,
+		&location, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt, &user.IsActive, &user.Role,
 	)
 
 	if err != nil {
@@ -283,12 +296,12 @@ func GetUserByID(userID uuid.UUID) (*User, error) {
 
 	err := Pool.QueryRow(ctx, `
 		SELECT id, username, first_name, last_name, email, phone, bio, avatar_url, 
-			   location, created_at, updated_at, last_login_at, is_active
+			   location, created_at, updated_at, last_login_at, is_active, role
 		FROM users WHERE id = $1
 	`, userID).Scan(
 		&user.ID, &username, &firstName, &lastName,
 		&email, &phone, &bio, &avatarURL,
-		&location, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt, &user.IsActive,
+		&location, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt, &user.IsActive, &user.Role,
 	)
 
 	if err != nil {
@@ -355,12 +368,12 @@ func addToUserHistory(ctx context.Context, tx pgx.Tx, userID uuid.UUID, tableNam
 
 		err = tx.QueryRow(ctx, `
 			SELECT id, username, first_name, last_name, email, phone, bio, avatar_url, 
-				   location, created_at, updated_at, last_login_at, is_active
+				   location, created_at, updated_at, last_login_at, is_active, role
 			FROM users WHERE id = $1
 		`, referenceID).Scan(
 			&user.ID, &username, &firstName, &lastName,
 			&email, &phone, &bio, &avatarURL,
-			&location, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt, &user.IsActive,
+			&location, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt, &user.IsActive, &user.Role,
 		)
 
 		if err != nil {
@@ -456,3 +469,89 @@ func addToUserHistory(ctx context.Context, tx pgx.Tx, userID uuid.UUID, tableNam
 
 	return nil
 }
+
+// GetUsersInfo получает краткую информацию и репутацию сразу о нескольких пользователях одним запросом
+func GetUsersInfo(ctx context.Context, userIDs []uuid.UUID) (map[uuid.UUID]*models.User, error) {
+	users := make(map[uuid.UUID]*models.User, len(userIDs))
+	if len(userIDs) == 0 {
+		return users, nil
+	}
+
+	rows, err := Pool.Query(ctx, `
+		SELECT u.id, COALESCE(u.username, ''), COALESCE(u.first_name, ''), COALESCE(u.last_name, ''), COALESCE(u.avatar_url, ''),
+		       rep.count, rep.average, rep.recent_average
+		FROM users u
+		`+reputationJoinSQL+`
+		WHERE u.id = ANY($1)
+	`, userIDs)
+
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении пользователей: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user models.User
+		var reviewCount int
+		var average float64
+		var recentAverage *float64
+		if err := rows.Scan(&user.ID, &user.Username, &user.FirstName, &user.LastName, &user.AvatarURL,
+			&reviewCount, &average, &recentAverage); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании пользователя: %w", err)
+		}
+		user.Reputation = models.NewReputation(reviewCount, average, recentAverage)
+		users[user.ID] = &user
+	}
+
+	return users, rows.Err()
+}
+
+// GetUserRole возвращает роль пользователя
+func GetUserRole(ctx context.Context, userID uuid.UUID) (string, error) {
+	var role string
+	err := Pool.QueryRow(ctx, "SELECT role FROM users WHERE id = $1", userID).Scan(&role)
+	if err != nil {
+		return "", err
+	}
+	return role, nil
+}
+
+// SetUserRole меняет роль пользователя и записывает изменение в историю.
+// Возвращает pgx.ErrNoRows, если пользователь не найден
+func SetUserRole(ctx context.Context, userID uuid.UUID, role string) error {
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE users SET role = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND role != $2
+	`, userID, role)
+	if err != nil {
+		return fmt.Errorf("ошибка при изменении роли пользователя: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		// Роль уже такая, если пользователь существует
+		var exists bool
+		if err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists); err != nil {
+			return fmt.Errorf("ошибка при проверке пользователя: %w", err)
+		}
+		if !exists {
+			return pgx.ErrNoRows
+		}
+		return nil
+	}
+
+	if err = addToUserHistory(ctx, tx, userID, "users", userID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+	}
+
+	return nil
+}
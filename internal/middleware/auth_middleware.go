@@ -1,14 +1,25 @@
 package middleware
 
 import (
+	"errors"
+	"log"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/google/uuid"
 
+	"github.com/rajivgeraev/flippy-api/internal/db"
+	"github.com/rajivgeraev/flippy-api/internal/models"
 	"github.com/rajivgeraev/flippy-api/internal/utils"
 )
 
+// sessionActivityInterval - как часто обновляется last_active сессии при ее использовании
+const sessionActivityInterval = 5 * time.Minute
+
+// errInvalidToken возвращается для недействительного токена или неверных данных в нем
+var errInvalidToken = errors.New("invalid or expired token")
+
 // AuthMiddleware создаёт middleware для проверки JWT
 func AuthMiddleware(jwtService *utils.JWTService) fiber.Handler {
 	return func(c fiber.Ctx) error {
@@ -27,25 +38,62 @@ func AuthMiddleware(jwtService *utils.JWTService) fiber.Handler {
 			})
 		}
 
-		tokenString := parts[1]
-		userID, err := jwtService.ExtractUserID(tokenString)
-		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid or expired token",
-			})
-		}
-
-		// Проверяем, что userID является валидным UUID
-		_, err = uuid.Parse(userID)
+		claims, err := Authenticate(jwtService, parts[1])
 		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid user ID",
+			if errors.Is(err, models.ErrSessionNotFound) {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Session has been revoked",
+				})
+			}
+			if errors.Is(err, errInvalidToken) {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Invalid or expired token",
+				})
+			}
+			log.Printf("Ошибка проверки сессии: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to verify session",
 			})
 		}
 
-		// Добавляем userID в контекст
-		c.Locals("userID", userID)
+		// Добавляем userID, сессию и роль в контекст
+		c.Locals("userID", claims.UserID)
+		c.Locals("sessionID", claims.SessionID)
+		c.Locals("role", claims.Role)
 
 		return c.Next()
 	}
 }
+
+// Authenticate проверяет access-токен и то, что его сессия не отозвана.
+// Роль в возвращаемых claims берется из базы, а не из токена
+func Authenticate(jwtService *utils.JWTService, tokenString string) (*utils.Claims, error) {
+	claims, err := jwtService.ParseToken(tokenString)
+	if err != nil {
+		return nil, errInvalidToken
+	}
+
+	// Проверяем, что userID и ID сессии являются валидными UUID
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return nil, errInvalidToken
+	}
+
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	role, err := db.TouchSession(ctx, sessionID, userID, sessionActivityInterval)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, models.ErrSessionNotFound
+	}
+	claims.Role = role
+
+	return claims, nil
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v3"
+
+	"github.com/rajivgeraev/flippy-api/internal/models"
+)
+
+// RequireRole создаёт middleware, пропускающее только пользователей с ролью не ниже required.
+// Должно подключаться после AuthMiddleware, которое кладет в контекст роль, прочитанную из базы
+func RequireRole(required string) fiber.Handler {
+	if !models.IsValidRole(required) {
+		panic(fmt.Sprintf("неизвестная роль %q", required))
+	}
+
+	return func(c fiber.Ctx) error {
+		role, _ := c.Locals("role").(string)
+		if !models.HasRole(role, required) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Insufficient permissions",
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -10,6 +10,7 @@ import (
 type Chat struct {
 	ID              uuid.UUID  `json:"id"`
 	TradeID         *uuid.UUID `json:"trade_id,omitempty"`
+	CycleID         *uuid.UUID `json:"cycle_id,omitempty"` // Круговой обмен, участники которого общаются в чате
 	SenderID        uuid.UUID  `json:"sender_id"`
 	ReceiverID      uuid.UUID  `json:"receiver_id"`
 	CreatedAt       time.Time  `json:"created_at"`
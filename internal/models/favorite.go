@@ -19,8 +19,9 @@ type Favorite struct {
 
 // FavoriteResponse представляет структуру ответа API с избранными объявлениями
 type FavoriteResponse struct {
-	Favorites []Favorite `json:"favorites"`
-	Total     int        `json:"total"`
-	Limit     int        `json:"limit"`
-	Offset    int        `json:"offset"`
+	Favorites  []Favorite `json:"favorites"`
+	Total      int        `json:"total"`
+	Limit      int        `json:"limit"`
+	Offset     int        `json:"offset"`
+	NextCursor *string    `json:"next_cursor"`
 }
@@ -17,9 +17,27 @@ type Listing struct {
 	Condition   string         `json:"condition"`
 	AllowTrade  bool           `json:"allow_trade"`
 	Status      string         `json:"status"`
+	City        string         `json:"city,omitempty"`
+	Latitude    *float64       `json:"-"` // Точные координаты не раскрываются
+	Longitude   *float64       `json:"-"`
 	Images      []ListingImage `json:"images"`
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
+
+	// Дополнительные поля для API
+	User *User `json:"user,omitempty"`
+
+	// Дополнительные поля для результатов поиска
+	Rank       float32           `json:"rank,omitempty"`
+	Highlight  *ListingHighlight `json:"highlight,omitempty"`
+	DistanceKm *float64          `json:"distance_km,omitempty"` // Округленное расстояние
+}
+
+// ListingHighlight содержит фрагменты объявления с подсвеченными совпадениями.
+// Текст экранирован для HTML, совпадения выделены тегом <b>
+type ListingHighlight struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
 }
 
 // ListingImage представляет изображение объявления
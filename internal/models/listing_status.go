@@ -0,0 +1,63 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Статусы объявления
+const (
+	ListingStatusDraft    = "draft"
+	ListingStatusActive   = "active"
+	ListingStatusReserved = "reserved" // Участвует в принятом обмене
+	ListingStatusTraded   = "traded"   // Обмен состоялся
+	ListingStatusArchived = "archived"
+	ListingStatusExpired  = "expired" // Давно не обновлялось и скрыто из ленты
+)
+
+// ErrInvalidListingTransition возвращается при недопустимой смене статуса объявления
+var ErrInvalidListingTransition = errors.New("недопустимая смена статуса объявления")
+
+// listingTransitions описывает допустимые переходы между статусами объявления
+var listingTransitions = map[string][]string{
+	ListingStatusDraft:    {ListingStatusActive, ListingStatusArchived},
+	ListingStatusActive:   {ListingStatusDraft, ListingStatusReserved, ListingStatusArchived, ListingStatusExpired},
+	ListingStatusReserved: {ListingStatusActive, ListingStatusTraded},
+	ListingStatusTraded:   {ListingStatusArchived},
+	ListingStatusArchived: {ListingStatusDraft, ListingStatusActive},
+	ListingStatusExpired:  {ListingStatusDraft, ListingStatusActive, ListingStatusArchived},
+}
+
+// ownerListingStatuses содержит статусы, которые владелец может установить сам.
+// Статусы reserved и traded выставляются только при обмене
+var ownerListingStatuses = map[string]bool{
+	ListingStatusDraft:    true,
+	ListingStatusActive:   true,
+	ListingStatusArchived: true,
+}
+
+// IsValidListingStatus проверяет, что статус объявления известен
+func IsValidListingStatus(status string) bool {
+	_, ok := listingTransitions[status]
+	return ok
+}
+
+// IsOwnerListingStatus проверяет, может ли владелец сам установить статус
+func IsOwnerListingStatus(status string) bool {
+	return ownerListingStatuses[status]
+}
+
+// ValidateListingTransition проверяет допустимость перехода объявления из статуса from в статус to
+func ValidateListingTransition(from, to string) error {
+	if from == to {
+		return nil
+	}
+
+	for _, allowed := range listingTransitions[from] {
+		if allowed == to {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: из %q в %q", ErrInvalidListingTransition, from, to)
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Типы сохраняемых уведомлений, совпадают с типами событий WebSocket
+const (
+	NotificationTradeUpdated  = "trade_updated"
+	NotificationTradeReminder = "trade_reminder"
+)
+
+// Notification представляет сохраненное уведомление пользователя.
+// Type и Payload совпадают с событием WebSocket, которое отправляется пользователю в сети
+type Notification struct {
+	ID        uuid.UUID       `json:"id"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+	ReadAt    *time.Time      `json:"read_at,omitempty"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Profile представляет профиль текущего пользователя со всеми его данными
+type Profile struct {
+	ID          uuid.UUID `json:"id"`
+	Username    string    `json:"username"`
+	FirstName   string    `json:"first_name"`
+	LastName    string    `json:"last_name"`
+	Email       string    `json:"email"`
+	Phone       string    `json:"phone"`
+	Bio         string    `json:"bio"`
+	AvatarURL   string    `json:"avatar_url"`
+	Location    string    `json:"location"`
+	Role        string    `json:"role"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+// PublicProfile представляет профиль, который видят другие пользователи.
+// Контактные данные в него не входят
+type PublicProfile struct {
+	*User
+	Bio            string     `json:"bio,omitempty"`
+	Location       string     `json:"location,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	TradeStats     TradeStats `json:"trade_stats"`
+	ActiveListings []Listing  `json:"active_listings"`
+	ListingsCount  int        `json:"listings_count"` // Всего активных объявлений
+}
+
+// TradeStats содержит статистику обменов пользователя
+type TradeStats struct {
+	Completed       int        `json:"completed"`
+	Active          int        `json:"active"` // Принятые, но еще не завершенные обмены
+	LastCompletedAt *time.Time `json:"last_completed_at,omitempty"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Направление изменения репутации за последнее время
+const (
+	ReputationTrendUp     = "up"
+	ReputationTrendDown   = "down"
+	ReputationTrendStable = "stable"
+)
+
+// reputationTrendThreshold - разница средних оценок, которая считается изменением
+const reputationTrendThreshold = 0.25
+
+// Review представляет отзыв участника о завершенном обмене
+type Review struct {
+	ID         uuid.UUID `json:"id"`
+	TradeID    uuid.UUID `json:"trade_id"`
+	ReviewerID uuid.UUID `json:"reviewer_id"`
+	RevieweeID uuid.UUID `json:"reviewee_id"`
+	Rating     int       `json:"rating"`
+	Comment    string    `json:"comment,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	// Дополнительные поля для API
+	Reviewer *User `json:"reviewer,omitempty"`
+}
+
+// Reputation представляет сводную оценку пользователя по отзывам
+type Reputation struct {
+	Count         int      `json:"count"`
+	Average       float64  `json:"average"`
+	RecentAverage *float64 `json:"recent_average,omitempty"` // Средняя оценка за последние 90 дней
+	Trend         string   `json:"trend,omitempty"`          // up, down, stable
+}
+
+// NewReputation собирает репутацию и вычисляет тренд по средней оценке за последнее время
+func NewReputation(count int, average float64, recentAverage *float64) *Reputation {
+	reputation := &Reputation{
+		Count:         count,
+		Average:       average,
+		RecentAverage: recentAverage,
+	}
+
+	if recentAverage != nil {
+		switch diff := *recentAverage - average; {
+		case diff > reputationTrendThreshold:
+			reputation.Trend = ReputationTrendUp
+		case diff < -reputationTrendThreshold:
+			reputation.Trend = ReputationTrendDown
+		default:
+			reputation.Trend = ReputationTrendStable
+		}
+	}
+
+	return reputation
+}
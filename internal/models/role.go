@@ -0,0 +1,27 @@
+package models
+
+// Роли пользователей. Каждая следующая роль включает права предыдущих
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// roleLevels задает старшинство ролей
+var roleLevels = map[string]int{
+	RoleUser:      1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+// IsValidRole проверяет, что роль существует
+func IsValidRole(role string) bool {
+	_, ok := roleLevels[role]
+	return ok
+}
+
+// HasRole проверяет, что роль не ниже требуемой. Неизвестная роль не дает никаких прав
+func HasRole(role, required string) bool {
+	level, ok := roleLevels[role]
+	return ok && level >= roleLevels[required]
+}
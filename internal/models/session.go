@@ -0,0 +1,30 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrSessionNotFound возвращается, если сессия не найдена, отозвана или истекла
+var ErrSessionNotFound = errors.New("сессия не найдена или отозвана")
+
+// ErrRefreshTokenReused возвращается при повторном использовании уже замененного refresh-токена.
+// Это признак кражи токена, поэтому сессия при этом отзывается
+var ErrRefreshTokenReused = errors.New("refresh-токен уже был использован")
+
+// Session представляет сессию пользователя на одном устройстве
+type Session struct {
+	ID               uuid.UUID  `json:"id"`
+	UserID           uuid.UUID  `json:"user_id"`
+	DeviceInfo       string     `json:"device_info"`
+	IPAddress        string     `json:"ip_address"`
+	LoginTime        time.Time  `json:"login_time"`
+	LastActive       time.Time  `json:"last_active"`
+	LogoutTime       *time.Time `json:"logout_time,omitempty"` // Время отзыва сессии
+	RefreshExpiresAt *time.Time `json:"refresh_expires_at,omitempty"`
+
+	// Дополнительные поля для API
+	Current bool `json:"current"` // Сессия, из которой выполнен запрос
+}
@@ -6,25 +6,45 @@ import (
 	"github.com/google/uuid"
 )
 
+// Стороны обмена, к которым относятся объявления
+const (
+	TradeSideSender   = "sender"
+	TradeSideReceiver = "receiver"
+)
+
 // Trade представляет предложение об обмене
 // Trade представляет предложение об обмене
 type Trade struct {
-	ID                uuid.UUID `json:"id"`
-	SenderID          uuid.UUID `json:"sender_id"`
-	ReceiverID        uuid.UUID `json:"receiver_id"`
-	SenderListingID   uuid.UUID `json:"sender_listing_id"`
-	ReceiverListingID uuid.UUID `json:"receiver_listing_id"`
-	Status            string    `json:"status"` // pending, accepted, rejected, canceled
-	Message           string    `json:"message"`
-	CreatedAt         time.Time `json:"created_at"`
-	UpdatedAt         time.Time `json:"updated_at"`
+	ID                uuid.UUID  `json:"id"`
+	SenderID          uuid.UUID  `json:"sender_id"`
+	ReceiverID        uuid.UUID  `json:"receiver_id"`
+	SenderListingID   *uuid.UUID `json:"sender_listing_id"` // Пусто, если объявление удалено
+	ReceiverListingID *uuid.UUID `json:"receiver_listing_id"`
+	Status            string     `json:"status"` // pending, accepted, completed, rejected, canceled, superseded, countered, expired
+	Message           string     `json:"message"`
+	ParentTradeID     *uuid.UUID `json:"parent_trade_id,omitempty"` // Предложение, на которое это является встречным
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+
+	// Подтверждение того, что обмен состоялся
+	AcceptedAt            *time.Time `json:"accepted_at,omitempty"`
+	SenderConfirmedAt     *time.Time `json:"sender_confirmed_at,omitempty"`
+	ReceiverConfirmedAt   *time.Time `json:"receiver_confirmed_at,omitempty"`
+	CompletedAt           *time.Time `json:"completed_at,omitempty"`
+	ConfirmationOverdueAt *time.Time `json:"confirmation_overdue_at,omitempty"` // Обмен не подтвердили вовремя
 
 	// Дополнительные поля для API
-	SenderListing   *Listing  `json:"sender_listing,omitempty"`
-	ReceiverListing *Listing  `json:"receiver_listing,omitempty"`
-	Sender          *User     `json:"sender,omitempty"`
-	Receiver        *User     `json:"receiver,omitempty"`
-	ChatID          uuid.UUID `json:"chat_id,omitempty"` // ID связанного чата
+	SenderListingIDs   []uuid.UUID `json:"sender_listing_ids"`   // Все объявления, которые отдает отправитель
+	ReceiverListingIDs []uuid.UUID `json:"receiver_listing_ids"` // Все объявления, которые отдает получатель
+	SenderListing      *Listing    `json:"sender_listing,omitempty"`
+	ReceiverListing    *Listing    `json:"receiver_listing,omitempty"`
+	SenderListings     []*Listing  `json:"sender_listings,omitempty"`
+	ReceiverListings   []*Listing  `json:"receiver_listings,omitempty"`
+	Sender             *User       `json:"sender,omitempty"`
+	Receiver           *User       `json:"receiver,omitempty"`
+	ChatID             uuid.UUID   `json:"chat_id,omitempty"`          // ID связанного чата
+	ExpiresAt          *time.Time  `json:"expires_at,omitempty"`       // Когда истечет ожидающее предложение
+	CounterTradeID     *uuid.UUID  `json:"counter_trade_id,omitempty"` // Встречное предложение, если оно было сделано
 }
 
 // User представляет минимальную информацию о пользователе для API
@@ -34,4 +54,6 @@ type User struct {
 	FirstName string    `json:"first_name,omitempty"`
 	LastName  string    `json:"last_name,omitempty"`
 	AvatarURL string    `json:"avatar_url,omitempty"`
+
+	Reputation *Reputation `json:"reputation,omitempty"` // Оценка пользователя по отзывам
 }
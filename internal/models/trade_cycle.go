@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Статусы кругового обмена
+const (
+	TradeCycleStatusProposed  = "proposed"
+	TradeCycleStatusActive    = "active"
+	TradeCycleStatusCompleted = "completed"
+	TradeCycleStatusRejected  = "rejected"
+	TradeCycleStatusCanceled  = "canceled"
+	TradeCycleStatusExpired   = "expired"
+)
+
+// TradeCycle представляет круговой обмен между несколькими пользователями
+type TradeCycle struct {
+	ID           uuid.UUID               `json:"id"`
+	Status       string                  `json:"status"` // proposed, active, completed, rejected, canceled, expired
+	CreatedAt    time.Time               `json:"created_at"`
+	UpdatedAt    time.Time               `json:"updated_at"`
+	ActivatedAt  *time.Time              `json:"activated_at,omitempty"` // Когда обмен приняли все участники
+	CompletedAt  *time.Time              `json:"completed_at,omitempty"`
+	Participants []TradeCycleParticipant `json:"participants"`
+}
+
+// TradeCycleParticipant представляет участника кругового обмена
+type TradeCycleParticipant struct {
+	UserID            uuid.UUID  `json:"user_id"`
+	Position          int        `json:"position"`
+	GivesListingID    *uuid.UUID `json:"gives_listing_id"`    // Объявление, которое участник отдает; nil, если оно удалено
+	ReceivesListingID *uuid.UUID `json:"receives_listing_id"` // Объявление, которое участник получает; nil, если оно удалено
+	AcceptedAt        *time.Time `json:"accepted_at,omitempty"`
+	ConfirmedAt       *time.Time `json:"confirmed_at,omitempty"` // Участник подтвердил, что получил объявление
+	ChatID            *uuid.UUID `json:"chat_id,omitempty"`      // Чат с участником, которому отдается объявление
+
+	// Дополнительные поля для API
+	User            *User    `json:"user,omitempty"`
+	GivesListing    *Listing `json:"gives_listing,omitempty"`
+	ReceivesListing *Listing `json:"receives_listing,omitempty"`
+}
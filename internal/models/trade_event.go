@@ -0,0 +1,34 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Типы событий в истории обмена
+const (
+	TradeEventCreated   = "created"
+	TradeEventCountered = "countered"
+	TradeEventAccepted  = "accepted"
+	TradeEventRejected  = "rejected"
+	TradeEventCanceled  = "canceled"
+	TradeEventConfirmed = "confirmed" // Одна из сторон подтвердила, что обмен состоялся
+	TradeEventCompleted = "completed"
+	TradeEventExpired   = "expired"
+)
+
+// TradeEvent представляет запись в истории обычного или кругового обмена
+type TradeEvent struct {
+	ID        uuid.UUID       `json:"id"`
+	TradeID   *uuid.UUID      `json:"trade_id,omitempty"`
+	CycleID   *uuid.UUID      `json:"cycle_id,omitempty"`
+	Type      string          `json:"type"`
+	ActorID   *uuid.UUID      `json:"actor_id"` // Пусто, если событие произошло автоматически
+	Data      json.RawMessage `json:"data,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+
+	// Дополнительные поля для API
+	Actor *User `json:"actor,omitempty"`
+}
@@ -0,0 +1,133 @@
+package admin
+
+import (
+	"log"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/rajivgeraev/flippy-api/internal/config"
+	"github.com/rajivgeraev/flippy-api/internal/db"
+	"github.com/rajivgeraev/flippy-api/internal/models"
+	"github.com/rajivgeraev/flippy-api/internal/utils"
+)
+
+// AdminService представляет сервис инструментов модерации и администрирования
+type AdminService struct {
+	cfg        *config.Config
+	jwtService *utils.JWTService
+}
+
+// staffMember описывает пользователя с ролью модератора или администратора
+type staffMember struct {
+	*models.User
+	Role string `json:"role"`
+}
+
+// NewAdminService создает новый экземпляр AdminService
+func NewAdminService(cfg *config.Config) *AdminService {
+	return &AdminService{
+		cfg:        cfg,
+		jwtService: utils.NewJWTService(cfg.JWT),
+	}
+}
+
+// GetStaff возвращает модераторов и администраторов
+func (s *AdminService) GetStaff(c fiber.Ctx) error {
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+        SELECT id, role FROM users WHERE role != $1 ORDER BY role, created_at
+    `, models.RoleUser)
+
+	if err != nil {
+		log.Printf("Ошибка запроса сотрудников: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения сотрудников"})
+	}
+	defer rows.Close()
+
+	var userIDs []uuid.UUID
+	roles := make(map[uuid.UUID]string)
+	for rows.Next() {
+		var userID uuid.UUID
+		var role string
+		if err := rows.Scan(&userID, &role); err != nil {
+			log.Printf("Ошибка сканирования сотрудника: %v", err)
+			continue
+		}
+		userIDs = append(userIDs, userID)
+		roles[userID] = role
+	}
+	rows.Close()
+
+	users, err := db.GetUsersInfo(ctx, userIDs)
+	if err != nil {
+		log.Printf("Ошибка получения пользователей: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения сотрудников"})
+	}
+
+	staff := make([]staffMember, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if user, ok := users[userID]; ok {
+			staff = append(staff, staffMember{User: user, Role: roles[userID]})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"staff": staff,
+		"count": len(staff),
+	})
+}
+
+// SetUserRole назначает пользователю роль. Роль читается из базы при каждом запросе,
+// поэтому новая роль действует со следующего запроса пользователя
+func (s *AdminService) SetUserRole(c fiber.Ctx) error {
+	adminID, err := uuid.Parse(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID пользователя"})
+	}
+
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID пользователя"})
+	}
+
+	var requestData struct {
+		Role string `json:"role"`
+	}
+
+	if err := c.Bind().Body(&requestData); err != nil {
+		log.Printf("Ошибка декодирования тела запроса: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	if !models.IsValidRole(requestData.Role) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Недопустимая роль"})
+	}
+
+	// Администратор не может понизить сам себя, чтобы не остаться без администраторов
+	if userID == adminID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Нельзя изменить собственную роль"})
+	}
+
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	if err := db.SetUserRole(ctx, userID, requestData.Role); err != nil {
+		if err == pgx.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Пользователь не найден"})
+		}
+		log.Printf("Ошибка изменения роли пользователя: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка изменения роли пользователя"})
+	}
+
+	log.Printf("Пользователь %s назначил пользователю %s роль %s", adminID, userID, requestData.Role)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"user_id": userID,
+		"role":    requestData.Role,
+	})
+}
@@ -0,0 +1,21 @@
+package admin
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/rajivgeraev/flippy-api/internal/middleware"
+	"github.com/rajivgeraev/flippy-api/internal/models"
+)
+
+// SetupRoutes настраивает маршруты для инструментов модерации и администрирования
+func (s *AdminService) SetupRoutes(app *fiber.App) {
+	// Группа доступна модераторам и администраторам
+	api := app.Group("/api/admin")
+	api.Use(middleware.AuthMiddleware(s.jwtService))
+	api.Use(middleware.RequireRole(models.RoleModerator))
+
+	// Маршрут для получения списка модераторов и администраторов
+	api.Get("/staff", s.GetStaff)
+
+	// Маршрут для назначения роли (только для администраторов)
+	api.Put("/users/:id/role", middleware.RequireRole(models.RoleAdmin), s.SetUserRole)
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"encoding/json"
+	"log"
 	"time"
 
 	"github.com/gofiber/fiber/v3"
@@ -9,6 +10,7 @@ import (
 	"github.com/rajivgeraev/flippy-api/internal/config"
 	"github.com/rajivgeraev/flippy-api/internal/db"
 	"github.com/rajivgeraev/flippy-api/internal/utils"
+	"github.com/rajivgeraev/flippy-api/internal/websocket"
 	initdata "github.com/telegram-mini-apps/init-data-golang"
 )
 
@@ -16,13 +18,15 @@ import (
 type AuthService struct {
 	cfg        *config.Config
 	jwtService *utils.JWTService
+	wsManager  *websocket.Manager // Закрывает WebSocket соединения отозванных сессий
 }
 
 // NewAuthService – конструктор AuthService
-func NewAuthService(cfg *config.Config) *AuthService {
+func NewAuthService(cfg *config.Config, wsManager *websocket.Manager) *AuthService {
 	return &AuthService{
 		cfg:        cfg,
-		jwtService: utils.NewJWTService(cfg.JWTSecret),
+		jwtService: utils.NewJWTService(cfg.JWT),
+		wsManager:  wsManager,
 	}
 }
 
@@ -83,21 +87,27 @@ func (s *AuthService) TelegramAuthHandler(c fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create/update user"})
 	}
 
-	// Генерируем JWT
+	// Создаем сессию и выдаем пару токенов
 	userIDString := user.ID.String()
-	jwtToken, err := s.jwtService.GenerateToken(userIDString)
+	tokens, err := s.startSession(c, user.ID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate JWT"})
+		log.Printf("Ошибка создания сессии: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create session"})
 	}
 
 	return c.JSON(fiber.Map{
-		"token": jwtToken,
+		"token":         tokens.AccessToken, // Для совместимости со старыми клиентами
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+		"session_id":    tokens.SessionID,
 		"user": fiber.Map{
 			"id":         userIDString,
 			"first_name": user.FirstName,
 			"last_name":  user.LastName,
 			"username":   user.Username,
 			"avatar_url": user.AvatarURL,
+			"role":       user.Role,
 		},
 	})
 }
@@ -120,19 +130,23 @@ func (s *AuthService) TestLoginHandler(c fiber.Ctx) error {
 	}
 
 	// Проверяем, что userID является валидным UUID
-	_, err := uuid.Parse(payload.UserID)
+	userID, err := uuid.Parse(payload.UserID)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID format"})
 	}
 
-	// Генерируем JWT
-	jwtToken, err := s.jwtService.GenerateToken(payload.UserID)
+	// Создаем сессию и выдаем пару токенов
+	tokens, err := s.startSession(c, userID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate JWT"})
+		log.Printf("Ошибка создания сессии: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create session"})
 	}
 
 	return c.JSON(fiber.Map{
-		"jwt_token": jwtToken,
-		"user_id":   payload.UserID,
+		"jwt_token":     tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+		"session_id":    tokens.SessionID,
+		"user_id":       payload.UserID,
 	})
 }
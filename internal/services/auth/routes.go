@@ -1,8 +1,6 @@
 package auth
 
 import (
-	"time"
-
 	"github.com/gofiber/fiber/v3"
 	"github.com/rajivgeraev/flippy-api/internal/middleware"
 )
@@ -12,6 +10,9 @@ func (s *AuthService) SetupRoutes(app *fiber.App) {
 	// Основной маршрут для аутентификации через Telegram
 	app.Post("/api/auth/telegram", s.TelegramAuthHandler)
 
+	// Обновление пары токенов по refresh-токену
+	app.Post("/api/auth/refresh", s.RefreshHandler)
+
 	// Добавляем тестовые маршруты только для разработки
 	if s.cfg.AppEnv == "development" {
 		app.Post("/api/auth/test-login", s.TestLoginHandler)
@@ -21,12 +22,11 @@ func (s *AuthService) SetupRoutes(app *fiber.App) {
 	protected := app.Group("/api")
 	protected.Use(middleware.AuthMiddleware(s.jwtService))
 
-	// Добавляем эндпоинт профиля
-	protected.Get("/profile", func(c fiber.Ctx) error {
-		userID := c.Locals("userID").(string)
-		return c.JSON(fiber.Map{
-			"message":   "Это защищенные данные для пользователя " + userID,
-			"timestamp": time.Now().Format(time.RFC3339),
-		})
-	})
+	// Выход с текущего устройства
+	protected.Post("/auth/logout", s.LogoutHandler)
+
+	// Управление сессиями на других устройствах
+	protected.Get("/auth/sessions", s.GetSessionsHandler)
+	protected.Delete("/auth/sessions", s.RevokeOtherSessionsHandler) // Выйти везде, кроме текущего устройства
+	protected.Delete("/auth/sessions/:id", s.RevokeSessionHandler)
 }
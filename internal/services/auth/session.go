@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+
+	"github.com/rajivgeraev/flippy-api/internal/db"
+	"github.com/rajivgeraev/flippy-api/internal/models"
+	"github.com/rajivgeraev/flippy-api/internal/utils"
+)
+
+// maxDeviceInfoLength ограничивает длину сохраняемого User-Agent
+const maxDeviceInfoLength = 255
+
+// tokenPair - токены, выдаваемые при входе и обновлении сессии
+type tokenPair struct {
+	SessionID    uuid.UUID
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int // Срок действия access-токена в секундах
+}
+
+// startSession создает сессию для устройства, с которого выполнен вход, и выдает токены
+func (s *AuthService) startSession(c fiber.Ctx, userID uuid.UUID) (*tokenPair, error) {
+	refreshToken, refreshTokenHash, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	deviceInfo := c.Get("User-Agent")
+	if len(deviceInfo) > maxDeviceInfoLength {
+		deviceInfo = deviceInfo[:maxDeviceInfoLength]
+	}
+
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	sessionID, err := db.CreateSession(ctx, userID, deviceInfo, c.IP(), refreshTokenHash, time.Now().Add(s.cfg.RefreshTokenTTL))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(userID, sessionID, refreshToken)
+}
+
+// issueTokens выдает access-токен для сессии вместе с уже сохраненным refresh-токеном.
+// Роль читается из базы, поэтому ее изменение попадает в токен при следующем обновлении
+func (s *AuthService) issueTokens(userID, sessionID uuid.UUID, refreshToken string) (*tokenPair, error) {
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	role, err := db.GetUserRole(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := s.jwtService.GenerateToken(userID.String(), sessionID.String(), role, s.cfg.AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenPair{
+		SessionID:    sessionID,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(s.cfg.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// RefreshHandler выдает новую пару токенов по refresh-токену. Предъявленный токен
+// после этого недействителен, а его повторное использование отзывает сессию
+func (s *AuthService) RefreshHandler(c fiber.Ctx) error {
+	var payload struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if err := c.Bind().Body(&payload); err != nil || payload.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	newRefreshToken, newRefreshTokenHash, err := utils.GenerateRefreshToken()
+	if err != nil {
+		log.Printf("Ошибка генерации refresh-токена: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to refresh session"})
+	}
+
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	session, err := db.RotateRefreshToken(ctx, utils.HashRefreshToken(payload.RefreshToken),
+		newRefreshTokenHash, time.Now().Add(s.cfg.RefreshTokenTTL))
+	if err != nil {
+		if errors.Is(err, models.ErrRefreshTokenReused) {
+			log.Printf("Повторное использование refresh-токена, сессия отозвана")
+			s.wsManager.CloseSession(session.UserID.String(), session.ID.String())
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Refresh token has already been used, session revoked"})
+		}
+		if errors.Is(err, models.ErrSessionNotFound) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired refresh token"})
+		}
+		log.Printf("Ошибка обновления сессии: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to refresh session"})
+	}
+
+	tokens, err := s.issueTokens(session.UserID, session.ID, newRefreshToken)
+	if err != nil {
+		log.Printf("Ошибка генерации access-токена: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to refresh session"})
+	}
+
+	return c.JSON(fiber.Map{
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+		"session_id":    tokens.SessionID,
+	})
+}
+
+// LogoutHandler отзывает текущую сессию. Ее access-токен перестает приниматься сразу,
+// а открытые по нему WebSocket соединения закрываются
+func (s *AuthService) LogoutHandler(c fiber.Ctx) error {
+	userID, sessionID, err := currentSession(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid session"})
+	}
+
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	if err := db.RevokeSession(ctx, sessionID, userID); err != nil && !errors.Is(err, models.ErrSessionNotFound) {
+		log.Printf("Ошибка завершения сессии: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to log out"})
+	}
+	s.wsManager.CloseSession(userID.String(), sessionID.String())
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// currentSession возвращает пользователя и сессию, установленные AuthMiddleware
+func currentSession(c fiber.Ctx) (uuid.UUID, uuid.UUID, error) {
+	userID, err := uuid.Parse(c.Locals("userID").(string))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+
+	sessionID, err := uuid.Parse(c.Locals("sessionID").(string))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+
+	return userID, sessionID, nil
+}
+
+// GetSessionsHandler возвращает устройства, на которых пользователь сейчас авторизован
+func (s *AuthService) GetSessionsHandler(c fiber.Ctx) error {
+	userID, sessionID, err := currentSession(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid session"})
+	}
+
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	sessions, err := db.GetActiveSessions(ctx, userID)
+	if err != nil {
+		log.Printf("Ошибка получения сессий: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get sessions"})
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == sessionID
+	}
+
+	return c.JSON(fiber.Map{
+		"sessions": sessions,
+		"count":    len(sessions),
+	})
+}
+
+// RevokeSessionHandler завершает одну из сессий пользователя, например на потерянном устройстве
+func (s *AuthService) RevokeSessionHandler(c fiber.Ctx) error {
+	userID, _, err := currentSession(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid session"})
+	}
+
+	targetID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid session ID format"})
+	}
+
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	if err := db.RevokeSession(ctx, targetID, userID); err != nil {
+		if errors.Is(err, models.ErrSessionNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Session not found"})
+		}
+		log.Printf("Ошибка завершения сессии: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke session"})
+	}
+	s.wsManager.CloseSession(userID.String(), targetID.String())
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// RevokeOtherSessionsHandler завершает все сессии пользователя, кроме текущей
+func (s *AuthService) RevokeOtherSessionsHandler(c fiber.Ctx) error {
+	userID, sessionID, err := currentSession(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid session"})
+	}
+
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	revoked, err := db.RevokeOtherSessions(ctx, userID, sessionID)
+	if err != nil {
+		log.Printf("Ошибка завершения сессий: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke sessions"})
+	}
+	s.wsManager.CloseOtherSessions(userID.String(), sessionID.String())
+
+	return c.JSON(fiber.Map{
+		"success":       true,
+		"revoked_count": revoked,
+	})
+}
@@ -2,6 +2,8 @@ package chat
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"log"
 	"time"
 
@@ -13,20 +15,31 @@ import (
 	"github.com/rajivgeraev/flippy-api/internal/db"
 	"github.com/rajivgeraev/flippy-api/internal/models"
 	"github.com/rajivgeraev/flippy-api/internal/utils"
+	"github.com/rajivgeraev/flippy-api/internal/websocket"
 )
 
+// errMessageNotFound возвращается, если сообщение не найдено в указанном чате
+var errMessageNotFound = errors.New("сообщение не найдено в чате")
+
 // ChatService представляет сервис для работы с чатами
 type ChatService struct {
 	cfg        *config.Config
 	jwtService *utils.JWTService
+	wsManager  *websocket.Manager
 }
 
 // NewChatService создает новый экземпляр ChatService
-func NewChatService(cfg *config.Config) *ChatService {
-	return &ChatService{
+func NewChatService(cfg *config.Config, wsManager *websocket.Manager) *ChatService {
+	s := &ChatService{
 		cfg:        cfg,
-		jwtService: utils.NewJWTService(cfg.JWTSecret),
+		jwtService: utils.NewJWTService(cfg.JWT),
+		wsManager:  wsManager,
 	}
+
+	// Отметки о прочтении могут приходить и через WebSocket
+	wsManager.SetMessageReadHandler(s.handleMessageReadEvent)
+
+	return s
 }
 
 // GetChats возвращает список чатов пользователя
@@ -48,7 +61,7 @@ func (s *ChatService) GetChats(c fiber.Ctx) error {
 
 	// Запрос списка чатов
 	query := `
-        SELECT c.id, c.trade_id, c.sender_id, c.receiver_id, c.created_at, c.updated_at,
+        SELECT c.id, c.trade_id, c.cycle_id, c.sender_id, c.receiver_id, c.created_at, c.updated_at,
                c.last_message_text, c.last_message_time, c.is_active,
                COUNT(m.id) FILTER (WHERE m.sender_id != $1 AND m.is_read = false) AS unread_count
         FROM chats c
@@ -76,6 +89,7 @@ func (s *ChatService) GetChats(c fiber.Ctx) error {
 		if err := rows.Scan(
 			&chat.ID,
 			&tradeID,
+			&chat.CycleID,
 			&chat.SenderID,
 			&chat.ReceiverID,
 			&chat.CreatedAt,
@@ -344,12 +358,177 @@ func (s *ChatService) SendMessage(c fiber.Ctx) error {
 		Sender:    getUserInfo(ctx, userUUID),
 	}
 
+	// Оповещаем собеседника о новом сообщении
+	recipientID := chat.ReceiverID
+	if chat.ReceiverID == userUUID {
+		recipientID = chat.SenderID
+	}
+	s.notifyNewMessage(ctx, message, recipientID)
+
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message": message,
 		"success": true,
 	})
 }
 
+// MarkAsRead отмечает прочитанными сообщения собеседника до указанного сообщения включительно
+func (s *ChatService) MarkAsRead(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	chatID := c.Params("id")
+
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Пользователь не авторизован"})
+	}
+
+	// Преобразуем ID в UUID
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID пользователя"})
+	}
+
+	chatUUID, err := uuid.Parse(chatID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID чата"})
+	}
+
+	// Получаем данные запроса
+	var requestData struct {
+		MessageID string `json:"message_id"` // Если не указан, отмечаются все сообщения
+	}
+
+	// Тело запроса необязательно
+	if len(c.Body()) > 0 {
+		if err := c.Bind().Body(&requestData); err != nil {
+			log.Printf("Ошибка чтения тела запроса: %v", err)
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат данных"})
+		}
+	}
+
+	var messageUUID *uuid.UUID
+	if requestData.MessageID != "" {
+		parsed, err := uuid.Parse(requestData.MessageID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID сообщения"})
+		}
+		messageUUID = &parsed
+	}
+
+	// Проверяем, имеет ли пользователь доступ к этому чату
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	var count int
+	err = db.Pool.QueryRow(ctx, `
+        SELECT COUNT(*) FROM chats 
+        WHERE id = $1 AND (sender_id = $2 OR receiver_id = $2)
+    `, chatUUID, userUUID).Scan(&count)
+
+	if err != nil {
+		log.Printf("Ошибка проверки доступа к чату: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка проверки доступа к чату"})
+	}
+
+	if count == 0 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "У вас нет доступа к этому чату"})
+	}
+
+	updated, err := s.markMessagesRead(ctx, chatUUID, userUUID, messageUUID)
+	if err != nil {
+		if errors.Is(err, errMessageNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Сообщение не найдено"})
+		}
+		log.Printf("Ошибка обновления статуса прочтения: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка обновления статуса прочтения"})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"chat_id": chatUUID,
+		"updated": updated,
+	})
+}
+
+// handleMessageReadEvent обрабатывает событие message_read, полученное через WebSocket.
+// Принадлежность пользователя к чату уже проверена менеджером
+func (s *ChatService) handleMessageReadEvent(chatID, messageID, userID string) {
+	chatUUID, err := uuid.Parse(chatID)
+	if err != nil {
+		return
+	}
+	messageUUID, err := uuid.Parse(messageID)
+	if err != nil {
+		return
+	}
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	if _, err := s.markMessagesRead(ctx, chatUUID, userUUID, &messageUUID); err != nil {
+		log.Printf("Ошибка обновления статуса прочтения: %v", err)
+	}
+}
+
+// markMessagesRead одним запросом отмечает прочитанными входящие сообщения чата
+// до upToMessageID включительно (или все, если он не указан) и оповещает участников
+func (s *ChatService) markMessagesRead(ctx context.Context, chatID, readerID uuid.UUID, upToMessageID *uuid.UUID) (int64, error) {
+	upTo := time.Now()
+	if upToMessageID != nil {
+		err := db.Pool.QueryRow(ctx, `
+            SELECT created_at FROM messages WHERE id = $1 AND chat_id = $2
+        `, *upToMessageID, chatID).Scan(&upTo)
+
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				return 0, errMessageNotFound
+			}
+			return 0, err
+		}
+	}
+
+	tag, err := db.Pool.Exec(ctx, `
+        UPDATE messages
+        SET is_read = true, updated_at = NOW()
+        WHERE chat_id = $1 AND sender_id != $2 AND is_read = false AND created_at <= $3
+    `, chatID, readerID, upTo)
+
+	if err != nil {
+		return 0, err
+	}
+
+	updated := tag.RowsAffected()
+	if updated == 0 {
+		return 0, nil
+	}
+
+	// Сообщаем отправителю, что его сообщения прочитаны
+	event := websocket.Event{
+		Type:      websocket.EventMessageRead,
+		ChatID:    chatID.String(),
+		UserID:    readerID.String(),
+		Timestamp: time.Now(),
+	}
+	if upToMessageID != nil {
+		event.MessageID = upToMessageID.String()
+	}
+	event.Payload, _ = json.Marshal(map[string]int64{"count": updated})
+
+	s.wsManager.SendToChat(chatID.String(), event, readerID.String())
+
+	// Обновляем счетчик непрочитанных чатов у читателя
+	unreadCount, err := getUnreadChatsCount(ctx, readerID)
+	if err != nil {
+		log.Printf("Ошибка подсчета непрочитанных чатов: %v", err)
+	} else {
+		s.wsManager.BroadcastUnreadCounts(readerID.String(), unreadCount)
+	}
+
+	return updated, nil
+}
+
 // CreateChat создает новый чат между пользователями
 func (s *ChatService) CreateChat(c fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
@@ -460,6 +639,16 @@ func (s *ChatService) CreateChat(c fiber.Ctx) error {
 				log.Printf("Ошибка фиксации транзакции: %v", err)
 				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка базы данных"})
 			}
+
+			s.notifyNewMessage(ctx, models.Message{
+				ID:        messageID,
+				ChatID:    *existingChatID,
+				SenderID:  senderUUID,
+				Text:      requestData.Message,
+				CreatedAt: now,
+				UpdatedAt: now,
+				Sender:    getUserInfo(ctx, senderUUID),
+			}, receiverUUID)
 		}
 
 		return c.JSON(fiber.Map{
@@ -517,8 +706,9 @@ func (s *ChatService) CreateChat(c fiber.Ctx) error {
 	}
 
 	// Если указано начальное сообщение, создаем его
+	var messageID uuid.UUID
 	if requestData.Message != "" {
-		messageID := uuid.New()
+		messageID = uuid.New()
 
 		_, err = tx.Exec(ctx, `
             INSERT INTO messages (id, chat_id, sender_id, text, is_read, created_at, updated_at)
@@ -549,6 +739,18 @@ func (s *ChatService) CreateChat(c fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка базы данных"})
 	}
 
+	if requestData.Message != "" {
+		s.notifyNewMessage(ctx, models.Message{
+			ID:        messageID,
+			ChatID:    chatID,
+			SenderID:  senderUUID,
+			Text:      requestData.Message,
+			CreatedAt: now,
+			UpdatedAt: now,
+			Sender:    getUserInfo(ctx, senderUUID),
+		}, receiverUUID)
+	}
+
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"chat_id": chatID,
 		"is_new":  true,
@@ -556,27 +758,59 @@ func (s *ChatService) CreateChat(c fiber.Ctx) error {
 	})
 }
 
-// getUserInfo получает базовую информацию о пользователе
-func getUserInfo(ctx context.Context, userID uuid.UUID) *models.User {
-	var user models.User
+// notifyNewMessage отправляет получателю событие о новом сообщении и обновленный счетчик непрочитанных чатов
+func (s *ChatService) notifyNewMessage(ctx context.Context, message models.Message, recipientID uuid.UUID) {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Ошибка сериализации сообщения: %v", err)
+		return
+	}
+
+	// Отправленное сообщение завершает набор текста
+	s.wsManager.StopTyping(message.ChatID.String(), message.SenderID.String())
+
+	// Отправляем событие всем участникам чата, кроме автора сообщения
+	s.wsManager.SendToChat(message.ChatID.String(), websocket.Event{
+		Type:      websocket.EventNewMessage,
+		ChatID:    message.ChatID.String(),
+		MessageID: message.ID.String(),
+		UserID:    message.SenderID.String(),
+		Timestamp: message.CreatedAt,
+		Payload:   payload,
+	}, message.SenderID.String())
+
+	unreadCount, err := getUnreadChatsCount(ctx, recipientID)
+	if err != nil {
+		log.Printf("Ошибка подсчета непрочитанных чатов: %v", err)
+		return
+	}
+
+	s.wsManager.BroadcastUnreadCounts(recipientID.String(), unreadCount)
+}
+
+// getUnreadChatsCount возвращает количество чатов пользователя с непрочитанными сообщениями
+func getUnreadChatsCount(ctx context.Context, userID uuid.UUID) (int, error) {
+	var count int
 	err := db.Pool.QueryRow(ctx, `
-        SELECT id, username, first_name, last_name, avatar_url
-        FROM users
-        WHERE id = $1
-    `, userID).Scan(
-		&user.ID,
-		&user.Username,
-		&user.FirstName,
-		&user.LastName,
-		&user.AvatarURL,
-	)
+        SELECT COUNT(DISTINCT c.id)
+        FROM chats c
+        JOIN messages m ON m.chat_id = c.id
+        WHERE (c.sender_id = $1 OR c.receiver_id = $1)
+          AND m.sender_id != $1 AND m.is_read = false
+    `, userID).Scan(&count)
 
+	return count, err
+}
+
+// getUserInfo получает базовую информацию о пользователе вместе с репутацией
+func getUserInfo(ctx context.Context, userID uuid.UUID) *models.User {
+	users, err := db.GetUsersInfo(ctx, []uuid.UUID{userID})
 	if err != nil {
 		log.Printf("Ошибка получения данных пользователя %s: %v", userID, err)
 		return nil
 	}
 
-	return &user
+	return users[userID]
 }
 
 // getTradeInfo получает базовую информацию об обмене
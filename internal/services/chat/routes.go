@@ -24,4 +24,7 @@ func (s *ChatService) SetupRoutes(app *fiber.App) {
 
 	// Маршрут для отправки сообщения
 	api.Post("/:id/messages", s.SendMessage)
+
+	// Маршрут для отметки сообщений как прочитанных
+	api.Post("/:id/read", s.MarkAsRead)
 }
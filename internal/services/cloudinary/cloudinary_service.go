@@ -27,7 +27,7 @@ type CloudinaryService struct {
 func NewCloudinaryService(cfg *config.Config) *CloudinaryService {
 	return &CloudinaryService{
 		cfg:          cfg,
-		jwtService:   utils.NewJWTService(cfg.JWTSecret),
+		jwtService:   utils.NewJWTService(cfg.JWT),
 		uploadPreset: cfg.CloudinaryConfig.UploadPreset,
 	}
 }
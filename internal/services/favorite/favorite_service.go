@@ -2,6 +2,7 @@ package favorite
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"strconv"
 
@@ -24,7 +25,7 @@ type FavoriteService struct {
 func NewFavoriteService(cfg *config.Config) *FavoriteService {
 	return &FavoriteService{
 		cfg:        cfg,
-		jwtService: utils.NewJWTService(cfg.JWTSecret),
+		jwtService: utils.NewJWTService(cfg.JWT),
 	}
 }
 
@@ -183,27 +184,43 @@ func (s *FavoriteService) GetFavorites(c fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID пользователя"})
 	}
 
-	// Параметры пагинации
-	limit := 20 // По умолчанию показываем 20 объявлений
+	// Параметры пагинации: курсор имеет приоритет над смещением
+	limit := utils.ParseLimit(c.Query("limit"))
 	offsetStr := c.Query("offset", "0")
 	offset, _ := strconv.Atoi(offsetStr)
 
+	var cursor *utils.Cursor
+	if cursorStr := c.Query("cursor"); cursorStr != "" {
+		if cursor, err = utils.DecodeCursor(cursorStr); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный курсор"})
+		}
+		offset = 0
+	}
+
 	// Получаем избранные объявления из базы данных
 	ctx, cancel := db.GetContext()
 	defer cancel()
 
 	// Запрос на получение избранных объявлений с информацией об объявлениях
-	query := `
+	where := "f.user_id = $1 AND l.status = 'active'"
+	args := []interface{}{userUUID}
+	if cursor != nil {
+		where += " AND (f.created_at, f.id) < ($2, $3)"
+		args = append(args, cursor.Time, cursor.ID)
+	}
+
+	// Запрашиваем на одну запись больше, чтобы понять, есть ли следующая страница
+	query := fmt.Sprintf(`
 		SELECT f.id, f.user_id, f.listing_id, f.created_at,
 			   l.id, l.user_id, l.title, l.description, l.categories, l.condition, l.allow_trade, l.status, l.created_at, l.updated_at
 		FROM favorites f
 		JOIN listings l ON f.listing_id = l.id
-		WHERE f.user_id = $1 AND l.status = 'active'
-		ORDER BY f.created_at DESC
-		LIMIT $2 OFFSET $3
-	`
+		WHERE %s
+		ORDER BY f.created_at DESC, f.id DESC
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)+1, len(args)+2)
 
-	rows, err := db.Pool.Query(ctx, query, userUUID, limit, offset)
+	rows, err := db.Pool.Query(ctx, query, append(args, limit+1, offset)...)
 	if err != nil {
 		log.Printf("Ошибка запроса избранных объявлений: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения избранных объявлений"})
@@ -211,7 +228,13 @@ func (s *FavoriteService) GetFavorites(c fiber.Ctx) error {
 	defer rows.Close()
 
 	var favorites []models.Favorite
+	fetched := 0
 	for rows.Next() {
+		fetched++
+		if fetched > limit {
+			break
+		}
+
 		var favorite models.Favorite
 		var listing models.Listing
 		var categoriesData []byte
@@ -242,44 +265,33 @@ func (s *FavoriteService) GetFavorites(c fiber.Ctx) error {
 			listing.Categories = []string{}
 		}
 
-		// Получаем изображения для объявления
-		imgRows, err := db.Pool.Query(ctx, `
-			SELECT id, listing_id, url, preview_url, public_id, file_name, is_main, position, created_at
-			FROM listing_images
-			WHERE listing_id = $1
-			ORDER BY position ASC
-		`, listing.ID)
-
-		if err != nil {
-			log.Printf("Ошибка запроса изображений: %v", err)
-		} else {
-			defer imgRows.Close()
-
-			var images []models.ListingImage
-			for imgRows.Next() {
-				var img models.ListingImage
-				if err := imgRows.Scan(
-					&img.ID,
-					&img.ListingID,
-					&img.URL,
-					&img.PreviewURL,
-					&img.PublicID,
-					&img.FileName,
-					&img.IsMain,
-					&img.Position,
-					&img.CreatedAt,
-				); err != nil {
-					log.Printf("Ошибка сканирования изображения: %v", err)
-					continue
-				}
-				images = append(images, img)
-			}
-			listing.Images = images
-		}
-
 		favorite.Listing = &listing
 		favorites = append(favorites, favorite)
 	}
+	rows.Close()
+
+	// Загружаем изображения для всех объявлений страницы одним запросом
+	listingIDs := make([]uuid.UUID, 0, len(favorites))
+	for _, favorite := range favorites {
+		listingIDs = append(listingIDs, favorite.ListingID)
+	}
+
+	images, err := db.GetListingImages(ctx, listingIDs)
+	if err != nil {
+		log.Printf("Ошибка запроса изображений: %v", err)
+	} else {
+		for i := range favorites {
+			favorites[i].Listing.Images = images[favorites[i].ListingID]
+		}
+	}
+
+	// Курсор следующей страницы строится по последней записи избранного
+	var nextCursor *string
+	if fetched > limit && len(favorites) > 0 {
+		last := favorites[len(favorites)-1]
+		encoded := utils.EncodeCursor(utils.Cursor{Time: last.CreatedAt, ID: last.ID})
+		nextCursor = &encoded
+	}
 
 	// Получаем общее количество избранных объявлений для пагинации
 	var total int
@@ -296,10 +308,11 @@ func (s *FavoriteService) GetFavorites(c fiber.Ctx) error {
 	}
 
 	return c.JSON(fiber.Map{
-		"favorites": favorites,
-		"total":     total,
-		"limit":     limit,
-		"offset":    offset,
+		"favorites":   favorites,
+		"total":       total,
+		"limit":       limit,
+		"offset":      offset,
+		"next_cursor": nextCursor,
 	})
 }
 
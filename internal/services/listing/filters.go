@@ -0,0 +1,239 @@
+package listing
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Измерения фильтра, по которым считаются фасеты
+const (
+	facetCategory  = "category"
+	facetCondition = "condition"
+)
+
+const (
+	// Радиус поиска рядом по умолчанию и максимальный радиус, км
+	defaultRadiusKm = 10
+	maxRadiusKm     = 200
+
+	// Средняя длина градуса широты, км
+	kmPerDegree = 111.32
+
+	// Шаг сетки приблизительного местоположения по широте (около 1.1 км).
+	// Совпадает с шагом в миграции 000019
+	locationCellDegrees = 0.01
+)
+
+// distanceBucketSQL дополнительно округляет расстояние до приблизительного местоположения:
+// до 1 км, затем с шагом 1 км до 10 км и 5 км дальше.
+// Сортировка и фильтр по радиусу тоже используют округленное значение
+const distanceBucketSQL = `CASE
+            WHEN d.km < 1 THEN 1
+            WHEN d.km < 10 THEN ceil(d.km)
+            ELSE ceil(d.km / 5) * 5
+        END`
+
+// validConditions содержит допустимые значения состояния товара
+var validConditions = map[string]bool{
+	"new": true, "excellent": true, "good": true,
+	"used": true, "needs_repair": true, "damaged": true,
+}
+
+// listingFilter описывает фильтры публичной ленты объявлений
+type listingFilter struct {
+	SearchQuery string
+	Categories  []string
+	Conditions  []string
+	AllowTrade  *bool
+	Near        *geoPoint
+	RadiusKm    float64
+}
+
+// geoPoint представляет точку на карте
+type geoPoint struct {
+	Lat float64
+	Lon float64
+}
+
+// parseListingFilter извлекает фильтры из параметров запроса
+func parseListingFilter(c fiber.Ctx) (listingFilter, error) {
+	filter := listingFilter{
+		SearchQuery: strings.TrimSpace(c.Query("q")),
+		Categories:  queryValues(c, "category"),
+	}
+
+	for _, condition := range queryValues(c, "condition") {
+		if !validConditions[condition] {
+			return filter, fmt.Errorf("недопустимое состояние: %s", condition)
+		}
+		filter.Conditions = append(filter.Conditions, condition)
+	}
+
+	if allowTrade := c.Query("allow_trade"); allowTrade != "" {
+		switch allowTrade {
+		case "true", "1":
+			value := true
+			filter.AllowTrade = &value
+		case "false", "0":
+			value := false
+			filter.AllowTrade = &value
+		default:
+			return filter, fmt.Errorf("недопустимое значение allow_trade: %s", allowTrade)
+		}
+	}
+
+	if near := c.Query("near"); near != "" {
+		point, err := parseGeoPoint(near)
+		if err != nil {
+			return filter, err
+		}
+		filter.Near = point
+
+		filter.RadiusKm = defaultRadiusKm
+		if radius := c.Query("radius_km"); radius != "" {
+			value, err := strconv.ParseFloat(radius, 64)
+			if err != nil || value <= 0 {
+				return filter, fmt.Errorf("недопустимый радиус: %s", radius)
+			}
+			filter.RadiusKm = math.Min(value, maxRadiusKm)
+		}
+	}
+
+	return filter, nil
+}
+
+// parseGeoPoint разбирает координаты в формате "lat,lon"
+func parseGeoPoint(value string) (*geoPoint, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("координаты должны быть в формате lat,lon")
+	}
+
+	lat, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return nil, fmt.Errorf("недопустимая широта: %s", parts[0])
+	}
+
+	lon, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return nil, fmt.Errorf("недопустимая долгота: %s", parts[1])
+	}
+
+	return &geoPoint{Lat: lat, Lon: lon}, nil
+}
+
+// validateCoordinates проверяет координаты объявления
+func validateCoordinates(lat, lon *float64) error {
+	if (lat == nil) != (lon == nil) {
+		return fmt.Errorf("широта и долгота указываются вместе")
+	}
+	if lat == nil {
+		return nil
+	}
+	if *lat < -90 || *lat > 90 || *lon < -180 || *lon > 180 {
+		return fmt.Errorf("недопустимые координаты")
+	}
+	return nil
+}
+
+// fuzzCoordinates возвращает приблизительное местоположение объявления - центр ячейки сетки,
+// в которую попадает точка. Ячейка одна и та же при каждом сохранении, поэтому повторные запросы
+// с разных точек не уточняют местоположение. По долготе шаг растягивается на 1/cos(широты),
+// чтобы ячейки были примерно квадратными
+func fuzzCoordinates(lat, lon *float64) (*float64, *float64) {
+	if lat == nil || lon == nil {
+		return nil, nil
+	}
+
+	fuzzedLat := math.Max(-90, math.Min(90, (math.Floor(*lat/locationCellDegrees)+0.5)*locationCellDegrees))
+
+	lonStep := locationCellDegrees / math.Max(math.Cos(fuzzedLat*math.Pi/180), 0.01)
+	fuzzedLon := math.Max(-180, math.Min(180, (math.Floor(*lon/lonStep)+0.5)*lonStep))
+
+	return &fuzzedLat, &fuzzedLon
+}
+
+// build формирует FROM, WHERE и аргументы запроса.
+// Фильтр по измерению exclude не применяется - так считаются фасеты.
+// Если задан поисковый запрос, он всегда передается первым аргументом и доступен как query,
+// а при поиске рядом округленное расстояние до приблизительного местоположения доступно как geo.distance_km.
+// Точные координаты объявления в запросе не участвуют
+func (f listingFilter) build(exclude string) (string, string, []interface{}) {
+	from := "listings l"
+	conditions := []string{"l.status = 'active'"}
+	var args []interface{}
+
+	if f.SearchQuery != "" {
+		// websearch_to_tsquery понимает кавычки, OR и минус и не падает на произвольном вводе
+		args = append(args, f.SearchQuery)
+		from += fmt.Sprintf(", websearch_to_tsquery('russian', $%d) query", len(args))
+		conditions = append(conditions, "l.search_vector @@ query")
+	}
+
+	if len(f.Categories) > 0 && exclude != facetCategory {
+		args = append(args, f.Categories)
+		conditions = append(conditions, fmt.Sprintf("l.categories ?| $%d", len(args)))
+	}
+
+	if len(f.Conditions) > 0 && exclude != facetCondition {
+		args = append(args, f.Conditions)
+		conditions = append(conditions, fmt.Sprintf("l.condition = ANY($%d)", len(args)))
+	}
+
+	if f.AllowTrade != nil {
+		args = append(args, *f.AllowTrade)
+		conditions = append(conditions, fmt.Sprintf("l.allow_trade = $%d", len(args)))
+	}
+
+	if f.Near != nil {
+		args = append(args, f.Near.Lat, f.Near.Lon)
+		latArg, lonArg := len(args)-1, len(args)
+
+		// Расстояние по формуле гаверсинусов до центра ячейки объявления
+		from += fmt.Sprintf(`,
+        LATERAL (SELECT 6371 * 2 * asin(sqrt(
+            power(sin(radians(l.fuzzed_latitude - $%[1]d::float8) / 2), 2) +
+            cos(radians($%[1]d::float8)) * cos(radians(l.fuzzed_latitude)) *
+            power(sin(radians(l.fuzzed_longitude - $%[2]d::float8) / 2), 2)
+        )) AS km) d,
+        LATERAL (SELECT (%[3]s)::float8 AS distance_km) geo`, latArg, lonArg, distanceBucketSQL)
+
+		args = append(args, f.RadiusKm)
+		conditions = append(conditions, "l.fuzzed_latitude IS NOT NULL",
+			fmt.Sprintf("geo.distance_km <= $%d", len(args)))
+
+		// Ограничивающий прямоугольник позволяет использовать индекс по координатам
+		latDelta := f.RadiusKm / kmPerDegree
+		args = append(args, f.Near.Lat-latDelta, f.Near.Lat+latDelta)
+		conditions = append(conditions, fmt.Sprintf("l.fuzzed_latitude BETWEEN $%d AND $%d", len(args)-1, len(args)))
+
+		if cosLat := math.Cos(f.Near.Lat * math.Pi / 180); cosLat > 0.01 {
+			lonDelta := f.RadiusKm / (kmPerDegree * cosLat)
+			// Прямоугольник, пересекающий 180-й меридиан, не строим
+			if f.Near.Lon-lonDelta >= -180 && f.Near.Lon+lonDelta <= 180 {
+				args = append(args, f.Near.Lon-lonDelta, f.Near.Lon+lonDelta)
+				conditions = append(conditions, fmt.Sprintf("l.fuzzed_longitude BETWEEN $%d AND $%d", len(args)-1, len(args)))
+			}
+		}
+	}
+
+	return from, strings.Join(conditions, " AND "), args
+}
+
+// queryValues возвращает значения параметра, переданного несколько раз
+// (category=lego&category=cars) или через запятую (condition=new,excellent)
+func queryValues(c fiber.Ctx, key string) []string {
+	var values []string
+	for _, raw := range c.RequestCtx().QueryArgs().PeekMulti(key) {
+		for _, value := range strings.Split(string(raw), ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
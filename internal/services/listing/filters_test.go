@@ -0,0 +1,150 @@
+package listing
+
+import (
+	"math"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// parseFilterQuery разбирает фильтры из строки запроса так же, как обработчик ленты
+func parseFilterQuery(t *testing.T, query string) (listingFilter, error) {
+	t.Helper()
+
+	var filter listingFilter
+	var parseErr error
+	app := fiber.New()
+	app.Get("/", func(c fiber.Ctx) error {
+		filter, parseErr = parseListingFilter(c)
+		return nil
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/?"+query, nil))
+	if err != nil {
+		t.Fatalf("запрос %q: %v", query, err)
+	}
+	resp.Body.Close()
+
+	return filter, parseErr
+}
+
+func TestParseListingFilter(t *testing.T) {
+	yes, no := true, false
+
+	tests := []struct {
+		name    string
+		query   string
+		want    listingFilter
+		wantErr bool
+	}{
+		{name: "без фильтров", query: ""},
+		{
+			name:  "поиск обрезается",
+			query: "q=%20велосипед%20",
+			want:  listingFilter{SearchQuery: "велосипед"},
+		},
+		{
+			name:  "категории через запятую и повтором",
+			query: "category=toys,%20books&category=sport&category=",
+			want:  listingFilter{Categories: []string{"toys", "books", "sport"}},
+		},
+		{
+			name:  "допустимые состояния",
+			query: "condition=new,used",
+			want:  listingFilter{Conditions: []string{"new", "used"}},
+		},
+		{name: "недопустимое состояние", query: "condition=broken", wantErr: true},
+		{name: "allow_trade true", query: "allow_trade=true", want: listingFilter{AllowTrade: &yes}},
+		{name: "allow_trade 0", query: "allow_trade=0", want: listingFilter{AllowTrade: &no}},
+		{name: "недопустимый allow_trade", query: "allow_trade=yes", wantErr: true},
+		{
+			name:  "радиус по умолчанию",
+			query: "near=55.75,37.62",
+			want:  listingFilter{Near: &geoPoint{Lat: 55.75, Lon: 37.62}, RadiusKm: defaultRadiusKm},
+		},
+		{
+			name:  "радиус ограничивается сверху",
+			query: "near=55.75,37.62&radius_km=1000",
+			want:  listingFilter{Near: &geoPoint{Lat: 55.75, Lon: 37.62}, RadiusKm: maxRadiusKm},
+		},
+		{
+			name:  "радиус без точки не учитывается",
+			query: "radius_km=5",
+		},
+		{name: "нулевой радиус", query: "near=55.75,37.62&radius_km=0", wantErr: true},
+		{name: "радиус не число", query: "near=55.75,37.62&radius_km=abc", wantErr: true},
+		{name: "одна координата", query: "near=55.75", wantErr: true},
+		{name: "широта вне диапазона", query: "near=91,37.62", wantErr: true},
+		{name: "долгота вне диапазона", query: "near=55.75,-181", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseFilterQuery(t, tt.query)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ожидалась ошибка, получен фильтр %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("неожиданная ошибка: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("получен фильтр %+v, ожидался %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFuzzCoordinates(t *testing.T) {
+	t.Run("без координат", func(t *testing.T) {
+		lat := 55.75
+		if fuzzedLat, fuzzedLon := fuzzCoordinates(&lat, nil); fuzzedLat != nil || fuzzedLon != nil {
+			t.Fatalf("для неполных координат ожидался nil")
+		}
+	})
+
+	points := []struct {
+		name     string
+		lat, lon float64
+	}{
+		{name: "Москва", lat: 55.755826, lon: 37.6173},
+		{name: "экватор", lat: 0.004, lon: -0.004},
+		{name: "южное полушарие", lat: -33.8688, lon: 151.2093},
+		{name: "у полюса", lat: 89.999, lon: 179.999},
+		{name: "у линии перемены дат", lat: 10, lon: -179.999},
+	}
+
+	for _, p := range points {
+		t.Run(p.name, func(t *testing.T) {
+			lat, lon := p.lat, p.lon
+			fuzzedLat, fuzzedLon := fuzzCoordinates(&lat, &lon)
+			if fuzzedLat == nil || fuzzedLon == nil {
+				t.Fatalf("ожидались координаты")
+			}
+
+			if *fuzzedLat < -90 || *fuzzedLat > 90 || *fuzzedLon < -180 || *fuzzedLon > 180 {
+				t.Fatalf("координаты вне допустимого диапазона: %f, %f", *fuzzedLat, *fuzzedLon)
+			}
+
+			// Точка остается в своей ячейке, но не совпадает с точным местоположением
+			if math.Abs(*fuzzedLat-lat) > locationCellDegrees {
+				t.Fatalf("широта смещена больше чем на ячейку: %f -> %f", lat, *fuzzedLat)
+			}
+			if *fuzzedLat == lat && *fuzzedLon == lon {
+				t.Fatalf("координаты не изменились")
+			}
+
+			// Соседняя точка той же ячейки дает то же приблизительное местоположение
+			nearLat, nearLon := lat+1e-7, lon+1e-7
+			againLat, againLon := fuzzCoordinates(&nearLat, &nearLon)
+			if *againLat != *fuzzedLat || *againLon != *fuzzedLon {
+				t.Fatalf("приблизительное местоположение меняется внутри ячейки: %f,%f и %f,%f",
+					*fuzzedLat, *fuzzedLon, *againLat, *againLon)
+			}
+		})
+	}
+}
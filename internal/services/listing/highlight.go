@@ -0,0 +1,27 @@
+package listing
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// Маркеры начала и конца совпадения в ts_headline. Это управляющие символы, а не теги:
+// фрагмент сначала экранируется, и только потом маркеры заменяются на <b> и </b>
+const (
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+// headlineSQL возвращает выражение ts_headline для столбца. Маркеры удаляются из исходного текста,
+// чтобы автор объявления не мог подставить свои
+func headlineSQL(column, options string) string {
+	return fmt.Sprintf(
+		`ts_headline('russian', translate(%s, chr(2) || chr(3), ''), query, 'StartSel=' || chr(2) || ', StopSel=' || chr(3) || ', %s')`,
+		column, options)
+}
+
+// renderHighlight экранирует HTML во фрагменте ts_headline и выделяет совпадения тегом <b>
+func renderHighlight(fragment string) string {
+	return strings.NewReplacer(highlightStart, "<b>", highlightStop, "</b>").Replace(html.EscapeString(fragment))
+}
@@ -1,9 +1,13 @@
 package listing
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/google/uuid"
@@ -33,7 +37,7 @@ type ListingService struct {
 func NewListingService(cfg *config.Config) *ListingService {
 	return &ListingService{
 		cfg:        cfg,
-		jwtService: utils.NewJWTService(cfg.JWTSecret),
+		jwtService: utils.NewJWTService(cfg.JWT),
 	}
 }
 
@@ -60,6 +64,9 @@ func (s *ListingService) CreateListing(c fiber.Ctx) error {
 		Status        string         `json:"status"`
 		UploadGroupID string         `json:"upload_group_id"`
 		Images        []RequestImage `json:"images"`
+		Latitude      *float64       `json:"latitude"`
+		Longitude     *float64       `json:"longitude"`
+		City          *string        `json:"city"`
 	}
 
 	if err := c.Bind().Body(&requestData); err != nil {
@@ -87,15 +94,15 @@ func (s *ListingService) CreateListing(c fiber.Ctx) error {
 		requestData.Status = "draft" // По умолчанию - черновик
 	}
 
-	validConditions := map[string]bool{
-		"new": true, "excellent": true, "good": true,
-		"used": true, "needs_repair": true, "damaged": true,
-	}
-
 	if !validConditions[requestData.Condition] {
 		requestData.Condition = "new" // По умолчанию - новое
 	}
 
+	// Координаты указываются только вместе и в допустимых пределах
+	if err := validateCoordinates(requestData.Latitude, requestData.Longitude); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	// Создаем ID для нового объявления
 	listingID := uuid.New()
 
@@ -110,12 +117,35 @@ func (s *ListingService) CreateListing(c fiber.Ctx) error {
 	}
 	defer tx.Rollback(ctx)
 
-	// Вставляем объявление
+	// Если местоположение не указано, берем его из профиля владельца
+	if requestData.Latitude == nil || requestData.City == nil {
+		var userLat, userLon *float64
+		var userCity *string
+		err = tx.QueryRow(ctx, `
+			SELECT latitude, longitude, location FROM users WHERE id = $1
+		`, userUUID).Scan(&userLat, &userLon, &userCity)
+
+		if err != nil {
+			log.Printf("Ошибка получения местоположения пользователя: %v", err)
+		} else {
+			if requestData.Latitude == nil {
+				requestData.Latitude, requestData.Longitude = userLat, userLon
+			}
+			if requestData.City == nil {
+				requestData.City = userCity
+			}
+		}
+	}
+
+	// Вставляем объявление вместе с приблизительным местоположением для поиска рядом
+	fuzzedLat, fuzzedLon := fuzzCoordinates(requestData.Latitude, requestData.Longitude)
 	_, err = tx.Exec(ctx, `
-		INSERT INTO listings (id, user_id, title, description, categories, condition, allow_trade, status)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO listings (id, user_id, title, description, categories, condition, allow_trade, status,
+		                      latitude, longitude, fuzzed_latitude, fuzzed_longitude, city)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 	`, listingID, userUUID, requestData.Title, requestData.Description,
-		requestData.Categories, requestData.Condition, requestData.AllowTrade, requestData.Status)
+		requestData.Categories, requestData.Condition, requestData.AllowTrade, requestData.Status,
+		requestData.Latitude, requestData.Longitude, fuzzedLat, fuzzedLon, requestData.City)
 
 	if err != nil {
 		log.Printf("Ошибка вставки объявления: %v", err)
@@ -185,36 +215,51 @@ func (s *ListingService) GetMyListings(c fiber.Ctx) error {
 
 	// Параметры фильтрации и пагинации
 	status := c.Query("status", "all") // all, active, draft
-	limit := 20                        // По умолчанию показываем 20 объявлений
+	limit := utils.ParseLimit(c.Query("limit"))
 	offsetStr := c.Query("offset", "0")
 	offset, _ := strconv.Atoi(offsetStr)
 
+	// Курсор имеет приоритет над смещением
+	var cursor *utils.Cursor
+	if cursorStr := c.Query("cursor"); cursorStr != "" {
+		if cursor, err = utils.DecodeCursor(cursorStr); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный курсор"})
+		}
+		offset = 0
+	}
+
 	// Получаем объявления из базы данных
 	ctx, cancel := db.GetContext()
 	defer cancel()
 
 	var listings []models.Listing
-	var rows pgx.Rows
-	var queryErr error
-
-	if status == "all" {
-		rows, queryErr = db.Pool.Query(ctx, `
-			SELECT id, user_id, title, description, categories, condition, allow_trade, status, created_at, updated_at
-			FROM listings
-			WHERE user_id = $1
-			ORDER BY updated_at DESC
-			LIMIT $2 OFFSET $3
-		`, userUUID, limit, offset)
-	} else {
-		rows, queryErr = db.Pool.Query(ctx, `
-			SELECT id, user_id, title, description, categories, condition, allow_trade, status, created_at, updated_at
-			FROM listings
-			WHERE user_id = $1 AND status = $2
-			ORDER BY updated_at DESC
-			LIMIT $3 OFFSET $4
-		`, userUUID, status, limit, offset)
+
+	conditions := []string{"user_id = $1"}
+	args := []interface{}{userUUID}
+
+	if status != "all" {
+		args = append(args, status)
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+	countWhere := strings.Join(conditions, " AND ")
+	countArgs := args
+
+	// Свои объявления сортируются по времени создания: оно не меняется при редактировании,
+	// поэтому объявление не перескакивает между страницами
+	if cursor != nil {
+		args = append(args, cursor.Time, cursor.ID)
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) < ($%d, $%d)", len(args)-1, len(args)))
 	}
 
+	// Запрашиваем на одну запись больше, чтобы понять, есть ли следующая страница
+	rows, queryErr := db.Pool.Query(ctx, fmt.Sprintf(`
+		SELECT id, user_id, title, description, categories, condition, allow_trade, status, COALESCE(city, ''), created_at, updated_at
+		FROM listings
+		WHERE %s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d OFFSET $%d
+	`, strings.Join(conditions, " AND "), len(args)+1, len(args)+2), append(args, limit+1, offset)...)
+
 	if queryErr != nil {
 		log.Printf("Ошибка запроса объявлений: %v", queryErr)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения объявлений"})
@@ -222,7 +267,13 @@ func (s *ListingService) GetMyListings(c fiber.Ctx) error {
 	defer rows.Close()
 
 	// Обрабатываем результаты
+	fetched := 0
 	for rows.Next() {
+		fetched++
+		if fetched > limit {
+			break
+		}
+
 		var listing models.Listing
 		if err := rows.Scan(
 			&listing.ID,
@@ -233,6 +284,7 @@ func (s *ListingService) GetMyListings(c fiber.Ctx) error {
 			&listing.Condition,
 			&listing.AllowTrade,
 			&listing.Status,
+			&listing.City,
 			&listing.CreatedAt,
 			&listing.UpdatedAt,
 		); err != nil {
@@ -240,68 +292,29 @@ func (s *ListingService) GetMyListings(c fiber.Ctx) error {
 			continue
 		}
 
-		// Получаем изображения для объявления
-		imgRows, err := db.Pool.Query(ctx, `
-			SELECT id, listing_id, url, preview_url, public_id, file_name, is_main, position, metadata, created_at
-			FROM listing_images
-			WHERE listing_id = $1
-			ORDER BY position ASC
-		`, listing.ID)
-
-		if err != nil {
-			log.Printf("Ошибка запроса изображений: %v", err)
-			continue
-		}
-
-		var images []models.ListingImage
-		for imgRows.Next() {
-			var img models.ListingImage
-			var metadataBytes []byte
-
-			if err := imgRows.Scan(
-				&img.ID,
-				&img.ListingID,
-				&img.URL,
-				&img.PreviewURL,
-				&img.PublicID,
-				&img.FileName,
-				&img.IsMain,
-				&img.Position,
-				&metadataBytes,
-				&img.CreatedAt,
-			); err != nil {
-				log.Printf("Ошибка сканирования изображения: %v", err)
-				continue
-			}
-
-			// Преобразуем метаданные из JSON, если они есть
-			if metadataBytes != nil {
-				if err := json.Unmarshal(metadataBytes, &img.Metadata); err != nil {
-					log.Printf("Ошибка разбора метаданных: %v", err)
-				}
-			}
+		listings = append(listings, listing)
+	}
+	rows.Close()
 
-			images = append(images, img)
-		}
-		imgRows.Close()
+	// Загружаем изображения и владельцев для всей страницы сразу
+	if err := db.AttachListingDetails(ctx, listings); err != nil {
+		log.Printf("Ошибка загрузки данных объявлений: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения объявлений"})
+	}
 
-		listing.Images = images
-		listings = append(listings, listing)
+	// Курсор следующей страницы строится по последнему объявлению
+	var nextCursor *string
+	if fetched > limit && len(listings) > 0 {
+		last := listings[len(listings)-1]
+		encoded := utils.EncodeCursor(utils.Cursor{Time: last.CreatedAt, ID: last.ID})
+		nextCursor = &encoded
 	}
 
 	// Получаем общее количество объявлений для пагинации
 	var total int
-	var countErr error
-
-	if status == "all" {
-		countErr = db.Pool.QueryRow(ctx, `
-			SELECT COUNT(*) FROM listings WHERE user_id = $1
-		`, userUUID).Scan(&total)
-	} else {
-		countErr = db.Pool.QueryRow(ctx, `
-			SELECT COUNT(*) FROM listings WHERE user_id = $1 AND status = $2
-		`, userUUID, status).Scan(&total)
-	}
+	countErr := db.Pool.QueryRow(ctx, fmt.Sprintf(`
+		SELECT COUNT(*) FROM listings WHERE %s
+	`, countWhere), countArgs...).Scan(&total)
 
 	if countErr != nil {
 		log.Printf("Ошибка подсчета объявлений: %v", countErr)
@@ -309,10 +322,11 @@ func (s *ListingService) GetMyListings(c fiber.Ctx) error {
 	}
 
 	return c.JSON(fiber.Map{
-		"listings": listings,
-		"total":    total,
-		"limit":    limit,
-		"offset":   offset,
+		"listings":    listings,
+		"total":       total,
+		"limit":       limit,
+		"offset":      offset,
+		"next_cursor": nextCursor,
 	})
 }
 
@@ -343,7 +357,7 @@ func (s *ListingService) GetListing(c fiber.Ctx) error {
 	var listing models.Listing
 	var ownerID uuid.UUID
 	err = db.Pool.QueryRow(ctx, `
-		SELECT id, user_id, title, description, categories, condition, allow_trade, status, created_at, updated_at
+		SELECT id, user_id, title, description, categories, condition, allow_trade, status, COALESCE(city, ''), created_at, updated_at
 		FROM listings
 		WHERE id = $1
 	`, listingUUID).Scan(
@@ -355,6 +369,7 @@ func (s *ListingService) GetListing(c fiber.Ctx) error {
 		&listing.Condition,
 		&listing.AllowTrade,
 		&listing.Status,
+		&listing.City,
 		&listing.CreatedAt,
 		&listing.UpdatedAt,
 	)
@@ -438,6 +453,12 @@ func (s *ListingService) GetListing(c fiber.Ctx) error {
 		log.Printf("Ошибка получения данных пользователя: %v", err)
 	}
 
+	// Репутация владельца помогает оценить надежность обмена
+	reputation, err := db.GetUserReputation(ctx, ownerID)
+	if err != nil {
+		log.Printf("Ошибка получения репутации пользователя: %v", err)
+	}
+
 	// Формируем ответ
 	return c.JSON(fiber.Map{
 		"listing": listing,
@@ -447,6 +468,7 @@ func (s *ListingService) GetListing(c fiber.Ctx) error {
 			"first_name": user.FirstName,
 			"last_name":  user.LastName,
 			"avatar_url": user.AvatarURL,
+			"reputation": reputation,
 		},
 		"is_owner": ownerID == userID,
 	})
@@ -482,6 +504,9 @@ func (s *ListingService) UpdateListing(c fiber.Ctx) error {
 		Status        string         `json:"status"`
 		UploadGroupID string         `json:"upload_group_id"`
 		Images        []RequestImage `json:"images"`
+		Latitude      *float64       `json:"latitude"`
+		Longitude     *float64       `json:"longitude"`
+		City          *string        `json:"city"`
 	}
 
 	if err := c.Bind().Body(&requestData); err != nil {
@@ -494,26 +519,27 @@ func (s *ListingService) UpdateListing(c fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Название обязательно"})
 	}
 
-	// Проверка статуса
-	if requestData.Status != "active" && requestData.Status != "draft" {
-		requestData.Status = "draft" // По умолчанию - черновик
-	}
-
-	validConditions := map[string]bool{
-		"new": true, "excellent": true, "good": true,
-		"used": true, "needs_repair": true, "damaged": true,
+	// Проверка статуса: владелец может выбрать только draft, active или archived
+	if requestData.Status != "" && !models.IsOwnerListingStatus(requestData.Status) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Недопустимый статус объявления"})
 	}
 
 	if !validConditions[requestData.Condition] {
 		requestData.Condition = "new" // По умолчанию - новое
 	}
 
+	// Координаты указываются только вместе и в допустимых пределах
+	if err := validateCoordinates(requestData.Latitude, requestData.Longitude); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	// Проверяем, что объявление существует и принадлежит пользователю
 	ctx, cancel := db.GetContext()
 	defer cancel()
 
 	var ownerID uuid.UUID
-	err = db.Pool.QueryRow(ctx, "SELECT user_id FROM listings WHERE id = $1", listingUUID).Scan(&ownerID)
+	var currentStatus string
+	err = db.Pool.QueryRow(ctx, "SELECT user_id, status FROM listings WHERE id = $1", listingUUID).Scan(&ownerID, &currentStatus)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Объявление не найдено"})
@@ -527,6 +553,17 @@ func (s *ListingService) UpdateListing(c fiber.Ctx) error {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "У вас нет доступа к редактированию этого объявления"})
 	}
 
+	// Если статус не передан, сохраняем текущий
+	if requestData.Status == "" {
+		requestData.Status = currentStatus
+	}
+
+	if err := models.ValidateListingTransition(currentStatus, requestData.Status); err != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Нельзя перевести объявление из статуса " + currentStatus + " в " + requestData.Status,
+		})
+	}
+
 	// Начинаем транзакцию
 	tx, err := db.Pool.Begin(ctx)
 	if err != nil {
@@ -547,6 +584,30 @@ func (s *ListingService) UpdateListing(c fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка обновления объявления"})
 	}
 
+	// Местоположение обновляется, только если передано в запросе
+	if requestData.Latitude != nil {
+		fuzzedLat, fuzzedLon := fuzzCoordinates(requestData.Latitude, requestData.Longitude)
+		_, err = tx.Exec(ctx, `
+			UPDATE listings SET latitude = $1, longitude = $2, fuzzed_latitude = $3, fuzzed_longitude = $4 WHERE id = $5
+		`, requestData.Latitude, requestData.Longitude, fuzzedLat, fuzzedLon, listingUUID)
+
+		if err != nil {
+			log.Printf("Ошибка обновления координат объявления: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка обновления объявления"})
+		}
+	}
+
+	if requestData.City != nil {
+		_, err = tx.Exec(ctx, `
+			UPDATE listings SET city = $1 WHERE id = $2
+		`, requestData.City, listingUUID)
+
+		if err != nil {
+			log.Printf("Ошибка обновления города объявления: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка обновления объявления"})
+		}
+	}
+
 	// Если есть изображения, обновляем их
 	if len(requestData.Images) > 0 {
 		// Сначала удаляем все существующие изображения
@@ -630,7 +691,8 @@ func (s *ListingService) DeleteListing(c fiber.Ctx) error {
 	defer cancel()
 
 	var ownerID uuid.UUID
-	err = db.Pool.QueryRow(ctx, "SELECT user_id FROM listings WHERE id = $1", listingUUID).Scan(&ownerID)
+	var status string
+	err = db.Pool.QueryRow(ctx, "SELECT user_id, status FROM listings WHERE id = $1", listingUUID).Scan(&ownerID, &status)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Объявление не найдено"})
@@ -644,6 +706,11 @@ func (s *ListingService) DeleteListing(c fiber.Ctx) error {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "У вас нет доступа к удалению этого объявления"})
 	}
 
+	// Зарезервированное объявление участвует в принятом обмене
+	if status == models.ListingStatusReserved {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Нельзя удалить объявление, зарезервированное для обмена"})
+	}
+
 	// Начинаем транзакцию
 	tx, err := db.Pool.Begin(ctx)
 	if err != nil {
@@ -652,6 +719,31 @@ func (s *ListingService) DeleteListing(c fiber.Ctx) error {
 	}
 	defer tx.Rollback(ctx)
 
+	// Повторно проверяем статус под блокировкой: объявление могли зарезервировать после первой проверки
+	err = tx.QueryRow(ctx, "SELECT status FROM listings WHERE id = $1 FOR UPDATE", listingUUID).Scan(&status)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Объявление не найдено"})
+		}
+		log.Printf("Ошибка запроса объявления: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка удаления объявления"})
+	}
+	if status == models.ListingStatusReserved {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Нельзя удалить объявление, зарезервированное для обмена"})
+	}
+
+	// Ожидающие предложения с этим объявлением отменяются, а не меняют состав после удаления
+	canceledTrades, err := db.CancelTradesWithListing(ctx, tx, listingUUID, userID, "Объявление из предложения было удалено")
+	if err != nil {
+		log.Printf("Ошибка отмены предложений с объявлением: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка удаления объявления"})
+	}
+
+	if err = db.CancelTradeCyclesWithListing(ctx, tx, listingUUID, userID); err != nil {
+		log.Printf("Ошибка отмены круговых обменов с объявлением: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка удаления объявления"})
+	}
+
 	// Сначала удаляем связанные изображения
 	_, err = tx.Exec(ctx, "DELETE FROM listing_images WHERE listing_id = $1", listingUUID)
 	if err != nil {
@@ -672,32 +764,99 @@ func (s *ListingService) DeleteListing(c fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка базы данных"})
 	}
 
+	canceledTradeIDs := make([]uuid.UUID, 0, len(canceledTrades))
+	for _, trade := range canceledTrades {
+		canceledTradeIDs = append(canceledTradeIDs, trade.ID)
+	}
+
 	return c.JSON(fiber.Map{
-		"success": true,
-		"message": "Объявление успешно удалено",
+		"success":            true,
+		"message":            "Объявление успешно удалено",
+		"canceled_trade_ids": canceledTradeIDs,
 	})
 }
 
 // GetPublicListings возвращает список публичных активных объявлений с пагинацией
 func (s *ListingService) GetPublicListings(c fiber.Ctx) error {
-	// Параметры пагинации
-	limit := 20 // По умолчанию показываем 20 объявлений
+	// Параметры пагинации: курсор имеет приоритет над смещением
+	limit := utils.ParseLimit(c.Query("limit"))
 	offsetStr := c.Query("offset", "0")
 	offset, _ := strconv.Atoi(offsetStr)
 
+	var cursor *utils.Cursor
+	if cursorStr := c.Query("cursor"); cursorStr != "" {
+		var err error
+		if cursor, err = utils.DecodeCursor(cursorStr); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный курсор"})
+		}
+		offset = 0
+	}
+
+	// Фильтры и поисковый запрос
+	filter, err := parseListingFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	searchQuery := filter.SearchQuery
+
 	// Получаем объявления из базы данных
 	ctx, cancel := db.GetContext()
 	defer cancel()
 
 	var listings []models.Listing
 
-	rows, queryErr := db.Pool.Query(ctx, `
-        SELECT id, user_id, title, description, categories, condition, allow_trade, status, created_at, updated_at
-        FROM listings
-        WHERE status = 'active'  -- Берем только активные объявления
-        ORDER BY created_at DESC  -- Сначала новые
-        LIMIT $1 OFFSET $2
-    `, limit, offset)
+	from, where, args := filter.build("")
+
+	selectFields := "l.id, l.user_id, l.title, l.description, l.categories, l.condition, l.allow_trade, l.status, COALESCE(l.city, ''), l.created_at, l.updated_at"
+	orderBy := "l.created_at DESC, l.id DESC" // Сначала новые
+
+	if searchQuery != "" {
+		selectFields += ", ts_rank_cd(l.search_vector, query) AS rank, " +
+			headlineSQL("l.title", "HighlightAll=true") + ", " +
+			headlineSQL("coalesce(l.description, '')", "MaxFragments=2, MaxWords=20, MinWords=5")
+		orderBy = "rank DESC, l.created_at DESC, l.id DESC"
+	}
+
+	// При поиске рядом сначала ближайшие, даже если задан поисковый запрос
+	if filter.Near != nil {
+		selectFields += ", geo.distance_km"
+		orderBy = "geo.distance_km ASC, l.id ASC"
+	}
+
+	// Условие курсора применяется только к выборке страницы, но не к подсчетам
+	pageWhere := where
+	pageArgs := args
+	if cursor != nil {
+		switch {
+		case filter.Near != nil:
+			if cursor.Distance == nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный курсор"})
+			}
+			pageArgs = append(pageArgs, *cursor.Distance, cursor.ID)
+			pageWhere += fmt.Sprintf(" AND (geo.distance_km, l.id) > ($%d::float8, $%d)", len(pageArgs)-1, len(pageArgs))
+		case searchQuery != "":
+			if cursor.Rank == nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный курсор"})
+			}
+			pageArgs = append(pageArgs, *cursor.Rank, cursor.Time, cursor.ID)
+			pageWhere += fmt.Sprintf(" AND (ts_rank_cd(l.search_vector, query), l.created_at, l.id) < ($%d::real, $%d, $%d)",
+				len(pageArgs)-2, len(pageArgs)-1, len(pageArgs))
+		default:
+			pageArgs = append(pageArgs, cursor.Time, cursor.ID)
+			pageWhere += fmt.Sprintf(" AND (l.created_at, l.id) < ($%d, $%d)", len(pageArgs)-1, len(pageArgs))
+		}
+	}
+
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM %s
+        WHERE %s
+        ORDER BY %s
+        LIMIT $%d OFFSET $%d
+    `, selectFields, from, pageWhere, orderBy, len(pageArgs)+1, len(pageArgs)+2)
+
+	// Запрашиваем на одну запись больше, чтобы понять, есть ли следующая страница
+	rows, queryErr := db.Pool.Query(ctx, query, append(pageArgs, limit+1, offset)...)
 
 	if queryErr != nil {
 		log.Printf("Ошибка запроса объявлений: %v", queryErr)
@@ -706,9 +865,15 @@ func (s *ListingService) GetPublicListings(c fiber.Ctx) error {
 	defer rows.Close()
 
 	// Обрабатываем результаты
+	fetched := 0
 	for rows.Next() {
+		fetched++
+		if fetched > limit {
+			break
+		}
+
 		var listing models.Listing
-		if err := rows.Scan(
+		dest := []interface{}{
 			&listing.ID,
 			&listing.UserID,
 			&listing.Title,
@@ -717,104 +882,135 @@ func (s *ListingService) GetPublicListings(c fiber.Ctx) error {
 			&listing.Condition,
 			&listing.AllowTrade,
 			&listing.Status,
+			&listing.City,
 			&listing.CreatedAt,
 			&listing.UpdatedAt,
-		); err != nil {
-			log.Printf("Ошибка сканирования строки: %v", err)
-			continue
 		}
 
-		// Получаем изображения для объявления
-		imgRows, err := db.Pool.Query(ctx, `
-            SELECT id, listing_id, url, preview_url, public_id, file_name, is_main, position, metadata, created_at
-            FROM listing_images
-            WHERE listing_id = $1
-            ORDER BY position ASC
-        `, listing.ID)
+		var highlight models.ListingHighlight
+		if searchQuery != "" {
+			dest = append(dest, &listing.Rank, &highlight.Title, &highlight.Description)
+		}
+		if filter.Near != nil {
+			dest = append(dest, &listing.DistanceKm)
+		}
 
-		if err != nil {
-			log.Printf("Ошибка запроса изображений: %v", err)
+		if err := rows.Scan(dest...); err != nil {
+			log.Printf("Ошибка сканирования строки: %v", err)
 			continue
 		}
 
-		var images []models.ListingImage
-		for imgRows.Next() {
-			var img models.ListingImage
-			var metadataBytes []byte
-
-			if err := imgRows.Scan(
-				&img.ID,
-				&img.ListingID,
-				&img.URL,
-				&img.PreviewURL,
-				&img.PublicID,
-				&img.FileName,
-				&img.IsMain,
-				&img.Position,
-				&metadataBytes,
-				&img.CreatedAt,
-			); err != nil {
-				log.Printf("Ошибка сканирования изображения: %v", err)
-				continue
-			}
-
-			// Преобразуем метаданные из JSON, если они есть
-			if metadataBytes != nil {
-				if err := json.Unmarshal(metadataBytes, &img.Metadata); err != nil {
-					log.Printf("Ошибка разбора метаданных: %v", err)
-				}
-			}
-
-			images = append(images, img)
+		if searchQuery != "" {
+			highlight.Title = renderHighlight(highlight.Title)
+			highlight.Description = renderHighlight(highlight.Description)
+			listing.Highlight = &highlight
 		}
-		imgRows.Close()
 
-		listing.Images = images
+		listings = append(listings, listing)
+	}
+	rows.Close()
 
-		// Для каждого объявления получаем информацию о пользователе
-		var user struct {
-			ID        uuid.UUID `json:"id"`
-			Username  string    `json:"username"`
-			FirstName string    `json:"first_name"`
-			LastName  string    `json:"last_name"`
-			AvatarURL string    `json:"avatar_url"`
-		}
+	// Загружаем изображения и владельцев для всей страницы сразу
+	if err := db.AttachListingDetails(ctx, listings); err != nil {
+		log.Printf("Ошибка загрузки данных объявлений: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения объявлений"})
+	}
 
-		err = db.Pool.QueryRow(ctx, `
-            SELECT id, username, first_name, last_name, avatar_url
-            FROM users
-            WHERE id = $1
-        `, listing.UserID).Scan(
-			&user.ID,
-			&user.Username,
-			&user.FirstName,
-			&user.LastName,
-			&user.AvatarURL,
-		)
-
-		// Даже если не удалось получить данные пользователя, мы все равно добавляем объявление
-		if err != nil && err != pgx.ErrNoRows {
-			log.Printf("Ошибка получения данных пользователя: %v", err)
+	// Курсор следующей страницы строится по последнему объявлению
+	var nextCursor *string
+	if fetched > limit && len(listings) > 0 {
+		last := listings[len(listings)-1]
+		next := utils.Cursor{Time: last.CreatedAt, ID: last.ID}
+		if searchQuery != "" {
+			next.Rank = &last.Rank
 		}
-
-		listings = append(listings, listing)
+		if filter.Near != nil {
+			next.Distance = last.DistanceKm
+		}
+		encoded := utils.EncodeCursor(next)
+		nextCursor = &encoded
 	}
 
 	// Получаем общее количество объявлений для пагинации
 	var total int
-	countErr := db.Pool.QueryRow(ctx, `
-        SELECT COUNT(*) FROM listings WHERE status = 'active'
-    `).Scan(&total)
+	countErr := db.Pool.QueryRow(ctx, fmt.Sprintf(`
+        SELECT COUNT(*) FROM %s WHERE %s
+    `, from, where), args...).Scan(&total)
 
 	if countErr != nil {
 		log.Printf("Ошибка подсчета объявлений: %v", countErr)
 		// Игнорируем ошибку, просто не вернем общее количество
 	}
 
+	// Считаем фасеты для чипов фильтров
+	categoryFacets, err := countFacet(ctx, filter, facetCategory, "jsonb_array_elements_text(l.categories)")
+	if err != nil {
+		log.Printf("Ошибка подсчета фасетов по категориям: %v", err)
+	}
+
+	conditionFacets, err := countFacet(ctx, filter, facetCondition, "l.condition")
+	if err != nil {
+		log.Printf("Ошибка подсчета фасетов по состоянию: %v", err)
+	}
+
 	return c.JSON(fiber.Map{
-		"listings": listings,
-		"total":    total,
-		"limit":    limit,
-		"offset":   offset,
+		"listings":    listings,
+		"total":       total,
+		"limit":       limit,
+		"offset":      offset,
+		"next_cursor": nextCursor,
+		"facets": fiber.Map{
+			"categories": categoryFacets,
+			"conditions": conditionFacets,
+		},
 	})
 }
+
+// countFacet считает количество объявлений по значениям измерения facet.
+// Фильтр по самому измерению не применяется, чтобы были видны альтернативы
+func countFacet(ctx context.Context, filter listingFilter, facet, valueExpr string) (map[string]int, error) {
+	from, where, args := filter.build(facet)
+
+	rows, err := db.Pool.Query(ctx, fmt.Sprintf(`
+        SELECT value, COUNT(*)
+        FROM %s, LATERAL (SELECT %s AS value) v
+        WHERE %s AND v.value IS NOT NULL
+        GROUP BY value
+    `, from, valueExpr, where), args...)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var value string
+		var count int
+		if err := rows.Scan(&value, &count); err != nil {
+			return nil, err
+		}
+		counts[value] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// StartExpirationWorker периодически переводит давно не обновлявшиеся активные объявления в статус expired
+func (s *ListingService) StartExpirationWorker(interval, ttl time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			expired, err := db.ExpireStaleListings(ttl)
+			if err != nil {
+				log.Printf("Ошибка истечения срока объявлений: %v", err)
+				continue
+			}
+			if expired > 0 {
+				log.Printf("Истек срок %d объявлений", expired)
+			}
+		}
+	}()
+}
@@ -0,0 +1,181 @@
+package listing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/rajivgeraev/flippy-api/internal/config"
+	"github.com/rajivgeraev/flippy-api/internal/db"
+)
+
+// queryCounter считает запросы, выполненные через пул
+type queryCounter struct {
+	queries atomic.Int64
+}
+
+func (q *queryCounter) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	q.queries.Add(1)
+	return ctx
+}
+
+func (q *queryCounter) TraceQueryEnd(context.Context, *pgx.Conn, pgx.TraceQueryEndData) {}
+
+// TestGetPublicListingsQueryCount проверяет, что количество запросов на страницу ленты
+// не зависит от количества объявлений на ней. Нужна база с примененными миграциями в TEST_DATABASE_URL
+func TestGetPublicListingsQueryCount(t *testing.T) {
+	feed := newFeedFixture(t)
+
+	small, large := feed.queriesPerPage(t, 1), feed.queriesPerPage(t, 20)
+	if small != large {
+		t.Fatalf("количество запросов зависит от размера страницы: %d для 1 объявления, %d для 20", small, large)
+	}
+}
+
+// BenchmarkGetPublicListings измеряет страницу ленты и сообщает количество запросов к базе на страницу
+// (queries/op), которое должно быть одинаковым для любого размера страницы.
+// Нужна база с примененными миграциями в TEST_DATABASE_URL
+func BenchmarkGetPublicListings(b *testing.B) {
+	feed := newFeedFixture(b)
+
+	for _, limit := range []int{1, 20} {
+		b.Run(fmt.Sprintf("limit=%d", limit), func(b *testing.B) {
+			var queries int64
+			for i := 0; i < b.N; i++ {
+				queries += feed.queriesPerPage(b, limit)
+			}
+			b.ReportMetric(float64(queries)/float64(b.N), "queries/op")
+		})
+	}
+}
+
+// feedFixture - лента с тестовыми объявлениями и счетчиком запросов к базе
+type feedFixture struct {
+	app      *fiber.App
+	counter  *queryCounter
+	category string
+}
+
+// newFeedFixture подключается к TEST_DATABASE_URL и создает 20 объявлений в отдельной категории.
+// Без TEST_DATABASE_URL тест пропускается
+func newFeedFixture(tb testing.TB) *feedFixture {
+	tb.Helper()
+
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		tb.Skip("TEST_DATABASE_URL не задан")
+	}
+
+	counter := &queryCounter{}
+	poolConfig, err := pgxpool.ParseConfig(databaseURL)
+	if err != nil {
+		tb.Fatalf("разбор TEST_DATABASE_URL: %v", err)
+	}
+	poolConfig.ConnConfig.Tracer = counter
+
+	ctx := context.Background()
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		tb.Fatalf("подключение к базе: %v", err)
+	}
+
+	previousPool := db.Pool
+	db.Pool = pool
+	tb.Cleanup(func() {
+		db.Pool = previousPool
+		pool.Close()
+	})
+
+	// Уникальная категория отделяет тестовые объявления от остальных
+	category := "query-count-" + uuid.NewString()
+	userID := seedListings(tb, ctx, pool, category, 20)
+	tb.Cleanup(func() {
+		pool.Exec(context.Background(), "DELETE FROM users WHERE id = $1", userID)
+	})
+
+	service := &ListingService{cfg: &config.Config{}}
+	app := fiber.New()
+	app.Get("/api/listings", service.GetPublicListings)
+
+	return &feedFixture{app: app, counter: counter, category: category}
+}
+
+// queriesPerPage запрашивает страницу ленты из limit объявлений и возвращает количество выполненных запросов.
+// Заодно проверяет, что у каждого объявления загружены изображения и владелец
+func (f *feedFixture) queriesPerPage(tb testing.TB, limit int) int64 {
+	tb.Helper()
+
+	before := f.counter.queries.Load()
+	req := httptest.NewRequest("GET", fmt.Sprintf("/api/listings?category=%s&limit=%d", f.category, limit), nil)
+	resp, err := f.app.Test(req)
+	if err != nil {
+		tb.Fatalf("запрос ленты: %v", err)
+	}
+	defer resp.Body.Close()
+	queries := f.counter.queries.Load() - before
+
+	var body struct {
+		Listings []struct {
+			Images []json.RawMessage `json:"images"`
+			User   json.RawMessage   `json:"user"`
+		} `json:"listings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		tb.Fatalf("разбор ответа: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusOK || len(body.Listings) != limit {
+		tb.Fatalf("limit=%d: статус %d, объявлений %d", limit, resp.StatusCode, len(body.Listings))
+	}
+	for _, listing := range body.Listings {
+		if len(listing.Images) == 0 || len(listing.User) == 0 {
+			tb.Fatalf("limit=%d: у объявления не загружены изображения или владелец", limit)
+		}
+	}
+
+	return queries
+}
+
+// seedListings создает пользователя и count активных объявлений с изображениями в категории category
+func seedListings(tb testing.TB, ctx context.Context, pool *pgxpool.Pool, category string, count int) uuid.UUID {
+	tb.Helper()
+
+	var userID uuid.UUID
+	err := pool.QueryRow(ctx, `
+		INSERT INTO users (first_name) VALUES ('Тест') RETURNING id
+	`).Scan(&userID)
+	if err != nil {
+		tb.Fatalf("создание пользователя: %v", err)
+	}
+
+	for i := 0; i < count; i++ {
+		var listingID uuid.UUID
+		err := pool.QueryRow(ctx, `
+			INSERT INTO listings (user_id, title, categories, status)
+			VALUES ($1, $2, jsonb_build_array($3::text), 'active')
+			RETURNING id
+		`, userID, fmt.Sprintf("Объявление %d", i), category).Scan(&listingID)
+		if err != nil {
+			tb.Fatalf("создание объявления: %v", err)
+		}
+
+		_, err = pool.Exec(ctx, `
+			INSERT INTO listing_images (listing_id, url, public_id, is_main, position)
+			VALUES ($1, 'https://example.com/1.jpg', $2, true, 0),
+			       ($1, 'https://example.com/2.jpg', $3, false, 1)
+		`, listingID, uuid.NewString(), uuid.NewString())
+		if err != nil {
+			tb.Fatalf("создание изображений: %v", err)
+		}
+	}
+
+	return userID
+}
@@ -0,0 +1,89 @@
+package notification
+
+import (
+	"log"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+
+	"github.com/rajivgeraev/flippy-api/internal/config"
+	"github.com/rajivgeraev/flippy-api/internal/db"
+	"github.com/rajivgeraev/flippy-api/internal/utils"
+)
+
+// NotificationService представляет сервис для работы с сохраненными уведомлениями
+type NotificationService struct {
+	cfg        *config.Config
+	jwtService *utils.JWTService
+}
+
+// NewNotificationService создает новый экземпляр NotificationService
+func NewNotificationService(cfg *config.Config) *NotificationService {
+	return &NotificationService{
+		cfg:        cfg,
+		jwtService: utils.NewJWTService(cfg.JWT),
+	}
+}
+
+// GetNotifications возвращает уведомления пользователя, в том числе пришедшие, пока он был не в сети
+func (s *NotificationService) GetNotifications(c fiber.Ctx) error {
+	userUUID, err := uuid.Parse(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID пользователя"})
+	}
+
+	unreadOnly := c.Query("unread") == "true"
+	limit := utils.ParseLimit(c.Query("limit"))
+
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	notifications, err := db.GetNotifications(ctx, userUUID, unreadOnly, limit)
+	if err != nil {
+		log.Printf("Ошибка получения уведомлений: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения уведомлений"})
+	}
+
+	unread, err := db.CountUnreadNotifications(ctx, userUUID)
+	if err != nil {
+		log.Printf("Ошибка подсчета уведомлений: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения уведомлений"})
+	}
+
+	return c.JSON(fiber.Map{
+		"notifications": notifications,
+		"unread_count":  unread,
+		"limit":         limit,
+	})
+}
+
+// MarkRead отмечает уведомления прочитанными. Без списка ID отмечаются все
+func (s *NotificationService) MarkRead(c fiber.Ctx) error {
+	userUUID, err := uuid.Parse(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID пользователя"})
+	}
+
+	var requestData struct {
+		IDs []uuid.UUID `json:"ids"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.Bind().Body(&requestData); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат данных"})
+		}
+	}
+
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	marked, err := db.MarkNotificationsRead(ctx, userUUID, requestData.IDs)
+	if err != nil {
+		log.Printf("Ошибка отметки уведомлений: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка обновления уведомлений"})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"marked":  marked,
+	})
+}
@@ -0,0 +1,21 @@
+package notification
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/rajivgeraev/flippy-api/internal/middleware"
+)
+
+// SetupRoutes настраивает маршруты для API уведомлений
+func (s *NotificationService) SetupRoutes(app *fiber.App) {
+	// Группа для API уведомлений
+	api := app.Group("/api/notifications")
+
+	// Защищенные маршруты (требуют авторизации)
+	api.Use(middleware.AuthMiddleware(s.jwtService))
+
+	// Маршрут для получения уведомлений
+	api.Get("/", s.GetNotifications)
+
+	// Маршрут для отметки уведомлений прочитанными
+	api.Post("/read", s.MarkRead)
+}
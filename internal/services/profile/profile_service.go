@@ -0,0 +1,222 @@
+package profile
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/rajivgeraev/flippy-api/internal/config"
+	"github.com/rajivgeraev/flippy-api/internal/db"
+	"github.com/rajivgeraev/flippy-api/internal/models"
+	"github.com/rajivgeraev/flippy-api/internal/utils"
+)
+
+// publicListingsLimit - сколько активных объявлений показывается в публичном профиле
+const publicListingsLimit = 20
+
+// pgUniqueViolation - код ошибки PostgreSQL при нарушении уникальности
+const pgUniqueViolation = "23505"
+
+// ProfileService представляет сервис для работы с профилями пользователей
+type ProfileService struct {
+	cfg        *config.Config
+	jwtService *utils.JWTService
+}
+
+// NewProfileService создает новый экземпляр ProfileService
+func NewProfileService(cfg *config.Config) *ProfileService {
+	return &ProfileService{
+		cfg:        cfg,
+		jwtService: utils.NewJWTService(cfg.JWT),
+	}
+}
+
+// GetProfile возвращает профиль текущего пользователя
+func (s *ProfileService) GetProfile(c fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID пользователя"})
+	}
+
+	return s.profileResponse(c, userID, fiber.Map{})
+}
+
+// UpdateProfile частично обновляет профиль текущего пользователя.
+// Каждое изменение сохраняется в истории пользователя
+func (s *ProfileService) UpdateProfile(c fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID пользователя"})
+	}
+
+	var requestData profileRequest
+	if err := c.Bind().Body(&requestData); err != nil {
+		log.Printf("Ошибка декодирования тела запроса: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	update, e := requestData.validate()
+	if e != nil {
+		return c.Status(e.Code).JSON(fiber.Map{"error": e.Message})
+	}
+
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	updated, err := db.UpdateUserProfile(ctx, userID, update)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Пользователь не найден"})
+		}
+
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+			message := "Имя пользователя уже занято"
+			if pgErr.ConstraintName == "users_email_key" {
+				message = "Email уже используется другим пользователем"
+			}
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": message})
+		}
+
+		log.Printf("Ошибка обновления профиля: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка обновления профиля"})
+	}
+
+	return s.profileResponse(c, userID, fiber.Map{"success": true, "updated": updated})
+}
+
+// profileResponse дополняет ответ текущим профилем пользователя
+func (s *ProfileService) profileResponse(c fiber.Ctx, userID uuid.UUID, response fiber.Map) error {
+	user, err := db.GetUserByID(userID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Пользователь не найден"})
+		}
+		log.Printf("Ошибка получения пользователя: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения профиля"})
+	}
+
+	response["profile"] = models.Profile{
+		ID:          user.ID,
+		Username:    user.Username,
+		FirstName:   user.FirstName,
+		LastName:    user.LastName,
+		Email:       user.Email,
+		Phone:       user.Phone,
+		Bio:         user.Bio,
+		AvatarURL:   user.AvatarURL,
+		Location:    user.Location,
+		Role:        user.Role,
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+		LastLoginAt: user.LastLoginAt,
+	}
+
+	return c.JSON(response)
+}
+
+// GetPublicProfile возвращает публичный профиль пользователя с его активными объявлениями,
+// репутацией и статистикой обменов
+func (s *ProfileService) GetPublicProfile(c fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID пользователя"})
+	}
+
+	user, err := db.GetUserByID(userID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Пользователь не найден"})
+		}
+		log.Printf("Ошибка получения пользователя: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения профиля"})
+	}
+
+	if !user.IsActive {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Пользователь не найден"})
+	}
+
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	// Краткая информация вместе с репутацией
+	users, err := db.GetUsersInfo(ctx, []uuid.UUID{userID})
+	if err != nil {
+		log.Printf("Ошибка получения пользователя: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения профиля"})
+	}
+
+	stats, err := db.GetUserTradeStats(ctx, userID)
+	if err != nil {
+		log.Printf("Ошибка получения статистики обменов: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения профиля"})
+	}
+
+	listings, count, err := getActiveListings(ctx, userID)
+	if err != nil {
+		log.Printf("Ошибка получения объявлений пользователя: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения профиля"})
+	}
+
+	return c.JSON(fiber.Map{
+		"profile": models.PublicProfile{
+			User:           users[userID],
+			Bio:            user.Bio,
+			Location:       user.Location,
+			CreatedAt:      user.CreatedAt,
+			TradeStats:     stats,
+			ActiveListings: listings,
+			ListingsCount:  count,
+		},
+	})
+}
+
+// getActiveListings возвращает последние активные объявления пользователя и их общее количество
+func getActiveListings(ctx context.Context, userID uuid.UUID) ([]models.Listing, int, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, user_id, title, description, categories, condition, allow_trade, status, COALESCE(city, ''),
+		       created_at, updated_at, COUNT(*) OVER ()
+		FROM listings
+		WHERE user_id = $1 AND status = $2
+		ORDER BY updated_at DESC, id DESC
+		LIMIT $3
+	`, userID, models.ListingStatusActive, publicListingsLimit)
+
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	listings := []models.Listing{}
+	listingIDs := []uuid.UUID{}
+	total := 0
+	for rows.Next() {
+		var listing models.Listing
+		if err := rows.Scan(&listing.ID, &listing.UserID, &listing.Title, &listing.Description, &listing.Categories,
+			&listing.Condition, &listing.AllowTrade, &listing.Status, &listing.City,
+			&listing.CreatedAt, &listing.UpdatedAt, &total); err != nil {
+			return nil, 0, err
+		}
+		listings = append(listings, listing)
+		listingIDs = append(listingIDs, listing.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	rows.Close()
+
+	images, err := db.GetListingImages(ctx, listingIDs)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range listings {
+		listings[i].Images = images[listings[i].ID]
+	}
+
+	return listings, total, nil
+}
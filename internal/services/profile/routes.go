@@ -0,0 +1,27 @@
+package profile
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/rajivgeraev/flippy-api/internal/middleware"
+)
+
+// SetupPublicRoutes настраивает публичные маршруты для профилей
+func (s *ProfileService) SetupPublicRoutes(app *fiber.App) {
+	// Публичный профиль пользователя виден всем
+	app.Get("/api/users/:id", s.GetPublicProfile)
+}
+
+// SetupRoutes настраивает маршруты для профиля текущего пользователя
+func (s *ProfileService) SetupRoutes(app *fiber.App) {
+	// Группа для API профиля
+	api := app.Group("/api/profile")
+
+	// Защищенные маршруты (требуют авторизации)
+	api.Use(middleware.AuthMiddleware(s.jwtService))
+
+	// Маршрут для получения своего профиля
+	api.Get("/", s.GetProfile)
+
+	// Маршрут для изменения своего профиля
+	api.Patch("/", s.UpdateProfile)
+}
@@ -0,0 +1,113 @@
+package profile
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v3"
+
+	"github.com/rajivgeraev/flippy-api/internal/db"
+)
+
+// Ограничения на длину полей профиля в символах
+const (
+	maxNameLength     = 100
+	maxBioLength      = 500
+	maxLocationLength = 100
+	maxURLLength      = 2048
+)
+
+var (
+	usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_]{3,32}$`)
+	phonePattern    = regexp.MustCompile(`^\+?[0-9][0-9 ()\-]{4,19}$`)
+)
+
+// profileRequest - тело запроса PATCH /api/profile. Отсутствующие поля не меняются
+type profileRequest struct {
+	Username  *string `json:"username"`
+	FirstName *string `json:"first_name"`
+	LastName  *string `json:"last_name"`
+	Email     *string `json:"email"`
+	Phone     *string `json:"phone"`
+	Bio       *string `json:"bio"`
+	AvatarURL *string `json:"avatar_url"`
+	Location  *string `json:"location"`
+}
+
+// validate нормализует и проверяет поля запроса и возвращает изменения для базы
+func (r profileRequest) validate() (db.ProfileUpdate, *fiber.Error) {
+	update := db.ProfileUpdate{
+		Username:  trimmed(r.Username),
+		FirstName: trimmed(r.FirstName),
+		LastName:  trimmed(r.LastName),
+		Email:     trimmed(r.Email),
+		Phone:     trimmed(r.Phone),
+		Bio:       trimmed(r.Bio),
+		AvatarURL: trimmed(r.AvatarURL),
+		Location:  trimmed(r.Location),
+	}
+
+	if update.Username != nil && !usernamePattern.MatchString(*update.Username) {
+		return update, fiber.NewError(fiber.StatusBadRequest,
+			"Имя пользователя должно состоять из 3-32 латинских букв, цифр или символов подчеркивания")
+	}
+
+	if update.FirstName != nil && *update.FirstName == "" {
+		return update, fiber.NewError(fiber.StatusBadRequest, "Имя не может быть пустым")
+	}
+
+	if e := checkLength(update.FirstName, maxNameLength, "Имя"); e != nil {
+		return update, e
+	}
+	if e := checkLength(update.LastName, maxNameLength, "Фамилия"); e != nil {
+		return update, e
+	}
+	if e := checkLength(update.Bio, maxBioLength, "Описание"); e != nil {
+		return update, e
+	}
+	if e := checkLength(update.Location, maxLocationLength, "Местоположение"); e != nil {
+		return update, e
+	}
+
+	if update.Email != nil && *update.Email != "" {
+		*update.Email = strings.ToLower(*update.Email)
+		addr, err := mail.ParseAddress(*update.Email)
+		if err != nil || addr.Address != *update.Email {
+			return update, fiber.NewError(fiber.StatusBadRequest, "Неверный формат email")
+		}
+	}
+
+	if update.Phone != nil && *update.Phone != "" && !phonePattern.MatchString(*update.Phone) {
+		return update, fiber.NewError(fiber.StatusBadRequest, "Неверный формат номера телефона")
+	}
+
+	if update.AvatarURL != nil && *update.AvatarURL != "" {
+		u, err := url.Parse(*update.AvatarURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" || len(*update.AvatarURL) > maxURLLength {
+			return update, fiber.NewError(fiber.StatusBadRequest, "Ссылка на аватар должна быть HTTPS-адресом")
+		}
+	}
+
+	return update, nil
+}
+
+// trimmed возвращает значение без пробелов по краям, сохраняя nil
+func trimmed(value *string) *string {
+	if value == nil {
+		return nil
+	}
+	v := strings.TrimSpace(*value)
+	return &v
+}
+
+// checkLength проверяет, что значение не длиннее max символов
+func checkLength(value *string, max int, field string) *fiber.Error {
+	if value != nil && utf8.RuneCountInString(*value) > max {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Поле «%s» не должно быть длиннее %d символов", field, max))
+	}
+	return nil
+}
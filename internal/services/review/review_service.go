@@ -0,0 +1,244 @@
+package review
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/rajivgeraev/flippy-api/internal/config"
+	"github.com/rajivgeraev/flippy-api/internal/db"
+	"github.com/rajivgeraev/flippy-api/internal/models"
+	"github.com/rajivgeraev/flippy-api/internal/utils"
+)
+
+// maxCommentLength ограничивает длину комментария к отзыву в символах
+const maxCommentLength = 1000
+
+// pgUniqueViolation - код ошибки PostgreSQL при нарушении уникальности
+const pgUniqueViolation = "23505"
+
+// ReviewService представляет сервис для работы с отзывами
+type ReviewService struct {
+	cfg        *config.Config
+	jwtService *utils.JWTService
+}
+
+// NewReviewService создает новый экземпляр ReviewService
+func NewReviewService(cfg *config.Config) *ReviewService {
+	return &ReviewService{
+		cfg:        cfg,
+		jwtService: utils.NewJWTService(cfg.JWT),
+	}
+}
+
+// CreateReview сохраняет отзыв участника о втором участнике завершенного обмена
+func (s *ReviewService) CreateReview(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Пользователь не авторизован"})
+	}
+
+	reviewerID, err := uuid.Parse(userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID пользователя"})
+	}
+
+	var requestData struct {
+		TradeID string `json:"trade_id"`
+		Rating  int    `json:"rating"`
+		Comment string `json:"comment"`
+	}
+
+	if err := c.Bind().Body(&requestData); err != nil {
+		log.Printf("Ошибка декодирования тела запроса: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	tradeID, err := uuid.Parse(requestData.TradeID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID обмена"})
+	}
+
+	if requestData.Rating < 1 || requestData.Rating > 5 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Оценка должна быть от 1 до 5"})
+	}
+
+	comment := strings.TrimSpace(requestData.Comment)
+	if utf8.RuneCountInString(comment) > maxCommentLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Комментарий не должен быть длиннее %d символов", maxCommentLength),
+		})
+	}
+
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	// Отзыв можно оставить только о втором участнике завершенного обмена
+	var senderID, receiverID uuid.UUID
+	var status string
+	err = db.Pool.QueryRow(ctx, `
+        SELECT sender_id, receiver_id, status FROM trades WHERE id = $1
+    `, tradeID).Scan(&senderID, &receiverID, &status)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Обмен не найден"})
+		}
+		log.Printf("Ошибка запроса обмена: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения обмена"})
+	}
+
+	var revieweeID uuid.UUID
+	switch reviewerID {
+	case senderID:
+		revieweeID = receiverID
+	case receiverID:
+		revieweeID = senderID
+	default:
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Вы не участвуете в этом обмене"})
+	}
+
+	if status != "completed" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Отзыв можно оставить только после завершения обмена"})
+	}
+
+	review := models.Review{
+		ID:         uuid.New(),
+		TradeID:    tradeID,
+		ReviewerID: reviewerID,
+		RevieweeID: revieweeID,
+		Rating:     requestData.Rating,
+		Comment:    comment,
+	}
+
+	err = db.Pool.QueryRow(ctx, `
+        INSERT INTO reviews (id, trade_id, reviewer_id, reviewee_id, rating, comment)
+        VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
+        RETURNING created_at
+    `, review.ID, review.TradeID, review.ReviewerID, review.RevieweeID, review.Rating, review.Comment).Scan(&review.CreatedAt)
+
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Вы уже оставили отзыв об этом обмене"})
+		}
+		log.Printf("Ошибка сохранения отзыва: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка сохранения отзыва"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"review":  review,
+		"message": "Отзыв успешно сохранен",
+	})
+}
+
+// GetUserReviews возвращает отзывы о пользователе и его репутацию
+func (s *ReviewService) GetUserReviews(c fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID пользователя"})
+	}
+
+	limit := utils.ParseLimit(c.Query("limit"))
+
+	var cursor *utils.Cursor
+	if cursorStr := c.Query("cursor"); cursorStr != "" {
+		if cursor, err = utils.DecodeCursor(cursorStr); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный курсор"})
+		}
+	}
+
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	var exists bool
+	if err := db.Pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists); err != nil {
+		log.Printf("Ошибка проверки пользователя: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения отзывов"})
+	}
+	if !exists {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Пользователь не найден"})
+	}
+
+	args := []interface{}{userID}
+	cursorCondition := ""
+	if cursor != nil {
+		args = append(args, cursor.Time, cursor.ID)
+		cursorCondition = "AND (created_at, id) < ($2, $3)"
+	}
+	args = append(args, limit+1)
+
+	// Запрашиваем на одну запись больше, чтобы понять, есть ли следующая страница
+	rows, err := db.Pool.Query(ctx, fmt.Sprintf(`
+        SELECT id, trade_id, reviewer_id, reviewee_id, rating, COALESCE(comment, ''), created_at
+        FROM reviews
+        WHERE reviewee_id = $1 %s
+        ORDER BY created_at DESC, id DESC
+        LIMIT $%d
+    `, cursorCondition, len(args)), args...)
+
+	if err != nil {
+		log.Printf("Ошибка запроса отзывов: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения отзывов"})
+	}
+	defer rows.Close()
+
+	reviews := []models.Review{}
+	reviewerIDs := []uuid.UUID{}
+	hasMore := false
+	for rows.Next() {
+		if len(reviews) == limit {
+			hasMore = true
+			break
+		}
+
+		var review models.Review
+		if err := rows.Scan(&review.ID, &review.TradeID, &review.ReviewerID, &review.RevieweeID,
+			&review.Rating, &review.Comment, &review.CreatedAt); err != nil {
+			log.Printf("Ошибка сканирования отзыва: %v", err)
+			continue
+		}
+
+		reviews = append(reviews, review)
+		reviewerIDs = append(reviewerIDs, review.ReviewerID)
+	}
+	rows.Close()
+
+	// Авторы отзывов загружаются одним запросом
+	reviewers, err := db.GetUsersInfo(ctx, reviewerIDs)
+	if err != nil {
+		log.Printf("Ошибка получения авторов отзывов: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения отзывов"})
+	}
+	for i := range reviews {
+		reviews[i].Reviewer = reviewers[reviews[i].ReviewerID]
+	}
+
+	var nextCursor *string
+	if hasMore {
+		last := reviews[len(reviews)-1]
+		encoded := utils.EncodeCursor(utils.Cursor{Time: last.CreatedAt, ID: last.ID})
+		nextCursor = &encoded
+	}
+
+	reputation, err := db.GetUserReputation(ctx, userID)
+	if err != nil {
+		log.Printf("Ошибка получения репутации: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения отзывов"})
+	}
+
+	return c.JSON(fiber.Map{
+		"reviews":     reviews,
+		"reputation":  reputation,
+		"limit":       limit,
+		"next_cursor": nextCursor,
+	})
+}
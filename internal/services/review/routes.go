@@ -0,0 +1,24 @@
+package review
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/rajivgeraev/flippy-api/internal/middleware"
+)
+
+// SetupPublicRoutes настраивает публичные маршруты для отзывов
+func (s *ReviewService) SetupPublicRoutes(app *fiber.App) {
+	// Отзывы о пользователе и его репутация видны всем
+	app.Get("/api/users/:id/reviews", s.GetUserReviews)
+}
+
+// SetupRoutes настраивает маршруты для API отзывов
+func (s *ReviewService) SetupRoutes(app *fiber.App) {
+	// Группа для API отзывов
+	api := app.Group("/api/reviews")
+
+	// Защищенные маршруты (требуют авторизации)
+	api.Use(middleware.AuthMiddleware(s.jwtService))
+
+	// Маршрут для отзыва о завершенном обмене
+	api.Post("/", s.CreateReview)
+}
@@ -0,0 +1,353 @@
+package trade
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/rajivgeraev/flippy-api/internal/db"
+	"github.com/rajivgeraev/flippy-api/internal/models"
+	"github.com/rajivgeraev/flippy-api/internal/websocket"
+)
+
+// Статус обмена, который обе стороны подтвердили
+const tradeStatusCompleted = "completed"
+
+// ConfirmTrade подтверждает, что принятый обмен состоялся.
+// Когда подтверждают обе стороны, обмен завершается, а его объявления переходят в статус traded
+func (s *TradeService) ConfirmTrade(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Пользователь не авторизован"})
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID пользователя"})
+	}
+
+	tradeUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID предложения обмена"})
+	}
+
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		log.Printf("Ошибка начала транзакции: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка базы данных"})
+	}
+	defer tx.Rollback(ctx)
+
+	// Блокируем обмен, чтобы одновременные подтверждения не потеряли друг друга
+	var trade models.Trade
+	err = tx.QueryRow(ctx, `
+        SELECT id, sender_id, receiver_id, status, sender_confirmed_at, receiver_confirmed_at
+        FROM trades
+        WHERE id = $1
+        FOR UPDATE
+    `, tradeUUID).Scan(&trade.ID, &trade.SenderID, &trade.ReceiverID, &trade.Status, &trade.SenderConfirmedAt, &trade.ReceiverConfirmedAt)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Предложение обмена не найдено"})
+		}
+		log.Printf("Ошибка запроса предложения обмена: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения предложения обмена"})
+	}
+
+	isSender := trade.SenderID == userUUID
+	if !isSender && trade.ReceiverID != userUUID {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Вы не участвуете в этом обмене"})
+	}
+
+	if trade.Status == tradeStatusCompleted {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Обмен уже завершен"})
+	}
+
+	if trade.Status != "accepted" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Подтвердить можно только принятый обмен"})
+	}
+
+	now := time.Now()
+	otherUserID := trade.ReceiverID
+	confirmedNow := false
+	if isSender {
+		if trade.SenderConfirmedAt == nil {
+			trade.SenderConfirmedAt = &now
+			confirmedNow = true
+		}
+	} else {
+		otherUserID = trade.SenderID
+		if trade.ReceiverConfirmedAt == nil {
+			trade.ReceiverConfirmedAt = &now
+			confirmedNow = true
+		}
+	}
+
+	completed := trade.SenderConfirmedAt != nil && trade.ReceiverConfirmedAt != nil
+	status := trade.Status
+	var completedAt *time.Time
+	if completed {
+		status = tradeStatusCompleted
+		completedAt = &now
+
+		// Объявления обеих сторон переходят из reserved в traded
+		senderListingIDs, receiverListingIDs, err := db.GetTradeListingIDs(ctx, tx, trade.ID)
+		if err != nil {
+			log.Printf("Ошибка получения объявлений обмена: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка подтверждения обмена"})
+		}
+
+		err = db.SetListingsStatus(ctx, tx, append(senderListingIDs, receiverListingIDs...), models.ListingStatusTraded)
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidListingTransition) || err == pgx.ErrNoRows {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Одно из объявлений обмена было изменено или удалено"})
+			}
+			log.Printf("Ошибка обновления статуса объявлений: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка подтверждения обмена"})
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+        UPDATE trades
+        SET status = $1, sender_confirmed_at = $2, receiver_confirmed_at = $3, completed_at = $4, updated_at = NOW()
+        WHERE id = $5
+    `, status, trade.SenderConfirmedAt, trade.ReceiverConfirmedAt, completedAt, trade.ID)
+
+	if err != nil {
+		log.Printf("Ошибка подтверждения обмена: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка подтверждения обмена"})
+	}
+
+	// Повторное подтверждение той же стороной в историю не попадает
+	if confirmedNow {
+		err = db.RecordTradeEvent(ctx, tx, trade.ID, models.TradeEventConfirmed, &userUUID, nil)
+		if err == nil && completed {
+			err = db.RecordTradeEvent(ctx, tx, trade.ID, models.TradeEventCompleted, &userUUID, nil)
+		}
+		if err != nil {
+			log.Printf("Ошибка записи истории обмена: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка подтверждения обмена"})
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		log.Printf("Ошибка фиксации транзакции: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка базы данных"})
+	}
+
+	message := "Подтверждение сохранено, ожидаем второго участника"
+	if completed {
+		message = "Обмен завершен"
+		s.notifyTradeUpdate(otherUserID, trade.ID, tradeStatusCompleted, "")
+
+		// После завершения обе стороны могут оставить отзыв друг о друге
+		s.sendReviewPrompt(trade.SenderID, trade.ID, trade.ReceiverID)
+		s.sendReviewPrompt(trade.ReceiverID, trade.ID, trade.SenderID)
+	} else {
+		s.notifyTradeUpdate(otherUserID, trade.ID, trade.Status, "Второй участник подтвердил, что обмен состоялся")
+	}
+
+	return c.JSON(fiber.Map{
+		"success":               true,
+		"message":               message,
+		"trade_id":              trade.ID,
+		"status":                status,
+		"sender_confirmed_at":   trade.SenderConfirmedAt,
+		"receiver_confirmed_at": trade.ReceiverConfirmedAt,
+		"completed_at":          completedAt,
+	})
+}
+
+// Причины автоматической отмены принятого обмена
+const cancelReasonConfirmationTimeout = "confirmation_timeout"
+
+// cancelAcceptedTrade отменяет принятый обмен по просьбе участника и возвращает его объявления в активные
+func (s *TradeService) cancelAcceptedTrade(c fiber.Ctx, trade models.Trade, userID uuid.UUID) error {
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		log.Printf("Ошибка начала транзакции: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка базы данных"})
+	}
+	defer tx.Rollback(ctx)
+
+	listingIDs, err := releaseAcceptedTrade(ctx, tx, trade.ID, &userID, "")
+	if err != nil {
+		if errors.Is(err, errTradeNotAccepted) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Отменить можно только принятый, но еще не завершенный обмен"})
+		}
+		log.Printf("Ошибка отмены принятого обмена: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка обновления статуса предложения"})
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		log.Printf("Ошибка фиксации транзакции: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка базы данных"})
+	}
+
+	otherUserID := trade.SenderID
+	if userID == trade.SenderID {
+		otherUserID = trade.ReceiverID
+	}
+	s.notifyTradeUpdate(otherUserID, trade.ID, "canceled", "Второй участник отменил принятый обмен")
+
+	return c.JSON(fiber.Map{
+		"success":              true,
+		"message":              "Обмен отменен, объявления снова доступны",
+		"trade_id":             trade.ID,
+		"status":               "canceled",
+		"released_listing_ids": listingIDs,
+	})
+}
+
+// errTradeNotAccepted возвращается, если обмен уже не находится в статусе accepted
+var errTradeNotAccepted = errors.New("обмен не находится в статусе accepted")
+
+// releaseAcceptedTrade отменяет принятый обмен и возвращает его зарезервированные объявления в активные.
+// Обмен блокируется раньше объявлений, как и в ConfirmTrade, чтобы отмена и подтверждение выполнялись по очереди.
+// actorID равен nil, если обмен отменен автоматически
+func releaseAcceptedTrade(ctx context.Context, tx pgx.Tx, tradeID uuid.UUID, actorID *uuid.UUID, reason string) ([]uuid.UUID, error) {
+	var status string
+	err := tx.QueryRow(ctx, "SELECT status FROM trades WHERE id = $1 FOR UPDATE", tradeID).Scan(&status)
+	if err != nil {
+		return nil, err
+	}
+	if status != "accepted" {
+		return nil, errTradeNotAccepted
+	}
+
+	senderListingIDs, receiverListingIDs, err := db.GetTradeListingIDs(ctx, tx, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	listingIDs := append(senderListingIDs, receiverListingIDs...)
+
+	if err := db.SetListingsStatus(ctx, tx, listingIDs, models.ListingStatusActive); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, `
+        UPDATE trades SET status = 'canceled', updated_at = NOW() WHERE id = $1
+    `, tradeID)
+	if err != nil {
+		return nil, err
+	}
+
+	eventData := map[string]interface{}{"released_listing_ids": listingIDs}
+	if reason != "" {
+		eventData["reason"] = reason
+	}
+	if err := db.RecordTradeEvent(ctx, tx, tradeID, models.TradeEventCanceled, actorID, eventData); err != nil {
+		return nil, err
+	}
+
+	return listingIDs, nil
+}
+
+// sendReviewPrompt предлагает пользователю оставить отзыв о втором участнике завершенного обмена
+func (s *TradeService) sendReviewPrompt(userID, tradeID, revieweeID uuid.UUID) {
+	payload, _ := json.Marshal(map[string]string{
+		"trade_id":    tradeID.String(),
+		"reviewee_id": revieweeID.String(),
+	})
+
+	s.wsManager.SendToUser(userID.String(), websocket.Event{
+		Type:      websocket.EventReviewPrompt,
+		Timestamp: time.Now(),
+		Payload:   payload,
+	})
+}
+
+// StartConfirmationWatcher периодически отмечает принятые обмены, которые не подтвердили за timeout,
+// и напоминает участникам, еще не подтвердившим обмен, что его можно подтвердить или отменить.
+// Если за следующий timeout никто так и не подтвердил обмен, он отменяется, а объявления освобождаются
+func (s *TradeService) StartConfirmationWatcher(interval, timeout time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			s.flagOverdueTrades(timeout)
+			s.cancelAbandonedTrades(timeout)
+		}
+	}()
+}
+
+// flagOverdueTrades напоминает участникам о неподтвержденных обменах
+func (s *TradeService) flagOverdueTrades(timeout time.Duration) {
+	trades, err := db.FlagOverdueTrades(timeout)
+	if err != nil {
+		log.Printf("Ошибка проверки неподтвержденных обменов: %v", err)
+		return
+	}
+
+	for _, trade := range trades {
+		reason := "Подтвердите, что обмен состоялся, или отмените его, чтобы освободить объявления"
+		if trade.SenderConfirmedAt == nil {
+			s.notifyTradeUpdate(trade.SenderID, trade.ID, "accepted", reason)
+		}
+		if trade.ReceiverConfirmedAt == nil {
+			s.notifyTradeUpdate(trade.ReceiverID, trade.ID, "accepted", reason)
+		}
+	}
+
+	if len(trades) > 0 {
+		log.Printf("Отмечено неподтвержденных обменов: %d", len(trades))
+	}
+}
+
+// cancelAbandonedTrades отменяет обмены, которые никто из участников не подтвердил
+// и после напоминания. Обмены, подтвержденные одной стороной, остаются на усмотрение участников
+func (s *TradeService) cancelAbandonedTrades(timeout time.Duration) {
+	trades, err := db.GetAbandonedTrades(timeout)
+	if err != nil {
+		log.Printf("Ошибка поиска брошенных обменов: %v", err)
+		return
+	}
+
+	canceled := 0
+	for _, trade := range trades {
+		ctx, cancel := db.GetContext()
+		err := func() error {
+			tx, err := db.Pool.Begin(ctx)
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback(ctx)
+
+			if _, err := releaseAcceptedTrade(ctx, tx, trade.ID, nil, cancelReasonConfirmationTimeout); err != nil {
+				return err
+			}
+			return tx.Commit(ctx)
+		}()
+		cancel()
+
+		if err != nil {
+			if !errors.Is(err, errTradeNotAccepted) {
+				log.Printf("Ошибка отмены брошенного обмена %s: %v", trade.ID, err)
+			}
+			continue
+		}
+
+		canceled++
+		reason := "Обмен отменен: никто из участников не подтвердил его вовремя"
+		s.notifyTradeUpdate(trade.SenderID, trade.ID, "canceled", reason)
+		s.notifyTradeUpdate(trade.ReceiverID, trade.ID, "canceled", reason)
+	}
+
+	if canceled > 0 {
+		log.Printf("Отменено брошенных обменов: %d", canceled)
+	}
+}
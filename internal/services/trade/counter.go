@@ -0,0 +1,176 @@
+package trade
+
+import (
+	"log"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/rajivgeraev/flippy-api/internal/db"
+	"github.com/rajivgeraev/flippy-api/internal/models"
+)
+
+// Статус предложения, на которое получатель ответил встречным
+const tradeStatusCountered = "countered"
+
+// CounterTrade создает встречное предложение в ответ на ожидающее предложение обмена.
+// Исходное предложение получает статус countered, поэтому принять можно только последнее предложение цепочки
+func (s *TradeService) CounterTrade(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Пользователь не авторизован"})
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID пользователя"})
+	}
+
+	parentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID предложения обмена"})
+	}
+
+	// Объявления встречного предложения указываются с точки зрения его автора:
+	// sender_listing_id(s) - что он отдает, receiver_listing_id(s) - что хочет получить.
+	// Не указанная сторона берется из исходного предложения
+	var requestData struct {
+		SenderListingID    string   `json:"sender_listing_id"`
+		ReceiverListingID  string   `json:"receiver_listing_id"`
+		SenderListingIDs   []string `json:"sender_listing_ids"`
+		ReceiverListingIDs []string `json:"receiver_listing_ids"`
+		Message            string   `json:"message"`
+	}
+
+	if err := c.Bind().Body(&requestData); err != nil {
+		log.Printf("Ошибка декодирования тела запроса: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	senderListingIDs, err := parseListingIDs(requestData.SenderListingID, requestData.SenderListingIDs)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	receiverListingIDs, err := parseListingIDs(requestData.ReceiverListingID, requestData.ReceiverListingIDs)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		log.Printf("Ошибка начала транзакции: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка базы данных"})
+	}
+	defer tx.Rollback(ctx)
+
+	// Блокируем исходное предложение, чтобы его не приняли одновременно со встречным
+	var parent models.Trade
+	err = tx.QueryRow(ctx, `
+        SELECT id, sender_id, receiver_id, sender_listing_id, receiver_listing_id, status
+        FROM trades
+        WHERE id = $1
+        FOR UPDATE
+    `, parentID).Scan(&parent.ID, &parent.SenderID, &parent.ReceiverID, &parent.SenderListingID, &parent.ReceiverListingID, &parent.Status)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Предложение обмена не найдено"})
+		}
+		log.Printf("Ошибка запроса предложения обмена: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения предложения обмена"})
+	}
+
+	if parent.ReceiverID != userUUID {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Только получатель предложения может сделать встречное предложение"})
+	}
+
+	if parent.Status != "pending" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Ответить можно только на предложение, которое находится в ожидании"})
+	}
+
+	parentSenderListingIDs, parentReceiverListingIDs, err := db.GetTradeListingIDs(ctx, tx, parent.ID)
+	if err != nil {
+		log.Printf("Ошибка получения объявлений обмена: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения предложения обмена"})
+	}
+
+	// Во встречном предложении стороны меняются местами
+	if len(senderListingIDs) == 0 {
+		senderListingIDs = parentReceiverListingIDs
+	}
+	if len(receiverListingIDs) == 0 {
+		receiverListingIDs = parentSenderListingIDs
+	}
+
+	if sameListingIDs(senderListingIDs, parentReceiverListingIDs) && sameListingIDs(receiverListingIDs, parentSenderListingIDs) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Встречное предложение должно отличаться от исходного"})
+	}
+
+	receiverID, e := validateTradeSides(ctx, tx, userUUID, senderListingIDs, receiverListingIDs)
+	if e != nil {
+		return c.Status(e.Code).JSON(fiber.Map{"error": e.Message})
+	}
+
+	if receiverID != parent.SenderID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Запрашиваемые объявления должны принадлежать автору исходного предложения"})
+	}
+
+	_, err = tx.Exec(ctx, `
+        UPDATE trades SET status = $1, updated_at = NOW() WHERE id = $2
+    `, tradeStatusCountered, parent.ID)
+
+	if err != nil {
+		log.Printf("Ошибка обновления исходного предложения: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка сохранения встречного предложения"})
+	}
+
+	tradeID := uuid.New()
+	_, err = tx.Exec(ctx, `
+        INSERT INTO trades (id, sender_id, receiver_id, sender_listing_id, receiver_listing_id, status, message, parent_trade_id)
+        VALUES ($1, $2, $3, $4, $5, 'pending', $6, $7)
+    `, tradeID, userUUID, parent.SenderID, senderListingIDs[0], receiverListingIDs[0], requestData.Message, parent.ID)
+
+	if err != nil {
+		log.Printf("Ошибка создания встречного предложения: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка сохранения встречного предложения"})
+	}
+
+	if err = db.CreateTradeItems(ctx, tx, tradeID, senderListingIDs, receiverListingIDs); err != nil {
+		log.Printf("Ошибка сохранения объявлений обмена: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка сохранения встречного предложения"})
+	}
+
+	err = db.RecordTradeEvent(ctx, tx, parent.ID, models.TradeEventCountered, &userUUID, map[string]interface{}{
+		"counter_trade_id": tradeID,
+	})
+	if err == nil {
+		err = db.RecordTradeEvent(ctx, tx, tradeID, models.TradeEventCreated, &userUUID, map[string]interface{}{
+			"parent_trade_id":      parent.ID,
+			"sender_listing_ids":   senderListingIDs,
+			"receiver_listing_ids": receiverListingIDs,
+		})
+	}
+	if err != nil {
+		log.Printf("Ошибка записи истории обмена: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка сохранения встречного предложения"})
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		log.Printf("Ошибка фиксации транзакции: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка базы данных"})
+	}
+
+	s.notifyTradeUpdate(parent.SenderID, parent.ID, tradeStatusCountered, "Получено встречное предложение")
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success":         true,
+		"trade_id":        tradeID,
+		"parent_trade_id": parent.ID,
+		"message":         "Встречное предложение успешно создано",
+	})
+}
@@ -0,0 +1,381 @@
+package trade
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/rajivgeraev/flippy-api/internal/db"
+	"github.com/rajivgeraev/flippy-api/internal/models"
+)
+
+// ConfirmCycle подтверждает, что участник получил объявление в активном круговом обмене.
+// Когда подтверждают все участники, обмен завершается, а его объявления переходят в статус traded
+func (s *TradeService) ConfirmCycle(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Пользователь не авторизован"})
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID пользователя"})
+	}
+
+	cycleID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID кругового обмена"})
+	}
+
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		log.Printf("Ошибка начала транзакции: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка базы данных"})
+	}
+	defer tx.Rollback(ctx)
+
+	status, isParticipant, err := lockCycle(ctx, tx, cycleID, userUUID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Круговой обмен не найден"})
+		}
+		log.Printf("Ошибка запроса кругового обмена: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения кругового обмена"})
+	}
+
+	if !isParticipant {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Вы не участвуете в этом обмене"})
+	}
+
+	if status == models.TradeCycleStatusCompleted {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Обмен уже завершен"})
+	}
+
+	if status != models.TradeCycleStatusActive {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Подтвердить можно только активный круговой обмен"})
+	}
+
+	// Повторное подтверждение не меняет время и не попадает в историю
+	tag, err := tx.Exec(ctx, `
+        UPDATE trade_cycle_participants SET confirmed_at = NOW()
+        WHERE cycle_id = $1 AND user_id = $2 AND confirmed_at IS NULL
+    `, cycleID, userUUID)
+
+	if err != nil {
+		log.Printf("Ошибка подтверждения кругового обмена: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка подтверждения обмена"})
+	}
+	confirmedNow := tag.RowsAffected() > 0
+
+	var waiting int
+	var listingIDs []uuid.UUID
+	err = tx.QueryRow(ctx, `
+        SELECT COUNT(*) FILTER (WHERE confirmed_at IS NULL), array_agg(gives_listing_id) FILTER (WHERE gives_listing_id IS NOT NULL)
+        FROM trade_cycle_participants
+        WHERE cycle_id = $1
+    `, cycleID).Scan(&waiting, &listingIDs)
+
+	if err != nil {
+		log.Printf("Ошибка проверки подтверждений кругового обмена: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка подтверждения обмена"})
+	}
+
+	completed := waiting == 0
+	if completed {
+		err = db.SetListingsStatus(ctx, tx, listingIDs, models.ListingStatusTraded)
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidListingTransition) || err == pgx.ErrNoRows {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Одно из объявлений обмена было изменено или удалено"})
+			}
+			log.Printf("Ошибка обновления статуса объявлений: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка подтверждения обмена"})
+		}
+
+		_, err = tx.Exec(ctx, `
+            UPDATE trade_cycles SET status = $1, completed_at = NOW(), updated_at = NOW() WHERE id = $2
+        `, models.TradeCycleStatusCompleted, cycleID)
+
+		if err != nil {
+			log.Printf("Ошибка завершения кругового обмена: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка подтверждения обмена"})
+		}
+	}
+
+	if confirmedNow {
+		err = db.RecordTradeCycleEvent(ctx, tx, cycleID, models.TradeEventConfirmed, &userUUID, nil)
+		if err == nil && completed {
+			err = db.RecordTradeCycleEvent(ctx, tx, cycleID, models.TradeEventCompleted, &userUUID, nil)
+		}
+		if err != nil {
+			log.Printf("Ошибка записи истории кругового обмена: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка подтверждения обмена"})
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		log.Printf("Ошибка фиксации транзакции: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка базы данных"})
+	}
+
+	participants, err := db.GetTradeCycleParticipants(ctx, []uuid.UUID{cycleID})
+	if err != nil {
+		log.Printf("Ошибка получения участников кругового обмена: %v", err)
+	}
+
+	status = models.TradeCycleStatusActive
+	message := "Подтверждение сохранено, ожидаем остальных участников"
+	if completed {
+		status = models.TradeCycleStatusCompleted
+		message = "Круговой обмен завершен"
+		s.notifyCycleUpdate(cycleID, participants[cycleID], status, "Все участники подтвердили круговой обмен", userUUID)
+	} else if confirmedNow {
+		s.notifyCycleUpdate(cycleID, participants[cycleID], status, "Один из участников подтвердил, что получил объявление", userUUID)
+	}
+
+	return c.JSON(fiber.Map{
+		"success":      true,
+		"message":      message,
+		"cycle_id":     cycleID,
+		"status":       status,
+		"participants": participants[cycleID],
+	})
+}
+
+// CancelCycle отменяет активный круговой обмен по просьбе участника и возвращает его объявления в активные
+func (s *TradeService) CancelCycle(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Пользователь не авторизован"})
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID пользователя"})
+	}
+
+	cycleID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID кругового обмена"})
+	}
+
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		log.Printf("Ошибка начала транзакции: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка базы данных"})
+	}
+	defer tx.Rollback(ctx)
+
+	_, isParticipant, err := lockCycle(ctx, tx, cycleID, userUUID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Круговой обмен не найден"})
+		}
+		log.Printf("Ошибка запроса кругового обмена: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения кругового обмена"})
+	}
+
+	if !isParticipant {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Вы не участвуете в этом обмене"})
+	}
+
+	listingIDs, err := releaseActiveCycle(ctx, tx, cycleID, models.TradeCycleStatusCanceled, &userUUID)
+	if err != nil {
+		if errors.Is(err, errCycleNotActive) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Отменить можно только активный, но еще не завершенный круговой обмен"})
+		}
+		log.Printf("Ошибка отмены кругового обмена: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка обновления кругового обмена"})
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		log.Printf("Ошибка фиксации транзакции: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка базы данных"})
+	}
+
+	participants, err := db.GetTradeCycleParticipants(ctx, []uuid.UUID{cycleID})
+	if err != nil {
+		log.Printf("Ошибка получения участников кругового обмена: %v", err)
+	} else {
+		s.notifyCycleUpdate(cycleID, participants[cycleID], models.TradeCycleStatusCanceled,
+			"Один из участников отменил круговой обмен", userUUID)
+	}
+
+	return c.JSON(fiber.Map{
+		"success":              true,
+		"message":              "Круговой обмен отменен, объявления снова доступны",
+		"cycle_id":             cycleID,
+		"status":               models.TradeCycleStatusCanceled,
+		"released_listing_ids": listingIDs,
+	})
+}
+
+// errCycleNotActive возвращается, если круговой обмен уже не находится в статусе active
+var errCycleNotActive = errors.New("круговой обмен не находится в статусе active")
+
+// releaseActiveCycle закрывает активный круговой обмен со статусом canceled или expired
+// и возвращает зарезервированные объявления в активные. Обмен блокируется раньше объявлений,
+// как и в ConfirmCycle. actorID равен nil, если обмен закрыт автоматически
+func releaseActiveCycle(ctx context.Context, tx pgx.Tx, cycleID uuid.UUID, status string, actorID *uuid.UUID) ([]uuid.UUID, error) {
+	var current string
+	err := tx.QueryRow(ctx, "SELECT status FROM trade_cycles WHERE id = $1 FOR UPDATE", cycleID).Scan(&current)
+	if err != nil {
+		return nil, err
+	}
+	if current != models.TradeCycleStatusActive {
+		return nil, errCycleNotActive
+	}
+
+	var listingIDs []uuid.UUID
+	err = tx.QueryRow(ctx, `
+        SELECT array_agg(gives_listing_id) FILTER (WHERE gives_listing_id IS NOT NULL)
+        FROM trade_cycle_participants WHERE cycle_id = $1
+    `, cycleID).Scan(&listingIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.SetListingsStatus(ctx, tx, listingIDs, models.ListingStatusActive); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, `
+        UPDATE trade_cycles SET status = $1, updated_at = NOW() WHERE id = $2
+    `, status, cycleID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Статусы canceled и expired совпадают с типами событий истории
+	eventData := map[string]interface{}{"released_listing_ids": listingIDs}
+	if err := db.RecordTradeCycleEvent(ctx, tx, cycleID, status, actorID, eventData); err != nil {
+		return nil, err
+	}
+
+	return listingIDs, nil
+}
+
+// expireActiveCycles закрывает активные круговые обмены, которые никто из участников не подтвердил
+// за срок подтверждения, и освобождает их объявления. Обмены, подтвержденные хотя бы одним участником,
+// остаются на усмотрение участников: любой из них может отменить обмен
+func (s *TradeService) expireActiveCycles() {
+	cycleIDs, err := db.GetOverdueActiveCycles(s.cfg.TradeConfirmTimeout)
+	if err != nil {
+		log.Printf("Ошибка поиска просроченных круговых обменов: %v", err)
+		return
+	}
+
+	var expired []uuid.UUID
+	for _, cycleID := range cycleIDs {
+		ctx, cancel := db.GetContext()
+		err := func() error {
+			tx, err := db.Pool.Begin(ctx)
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback(ctx)
+
+			if _, err := releaseActiveCycle(ctx, tx, cycleID, models.TradeCycleStatusExpired, nil); err != nil {
+				return err
+			}
+			return tx.Commit(ctx)
+		}()
+		cancel()
+
+		if err != nil {
+			if !errors.Is(err, errCycleNotActive) {
+				log.Printf("Ошибка закрытия просроченного кругового обмена %s: %v", cycleID, err)
+			}
+			continue
+		}
+		expired = append(expired, cycleID)
+	}
+
+	if len(expired) == 0 {
+		return
+	}
+
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	participants, err := db.GetTradeCycleParticipants(ctx, expired)
+	if err != nil {
+		log.Printf("Ошибка получения участников круговых обменов: %v", err)
+		return
+	}
+
+	for _, cycleID := range expired {
+		s.notifyCycleUpdate(cycleID, participants[cycleID], models.TradeCycleStatusExpired,
+			"Круговой обмен закрыт: никто из участников не подтвердил его вовремя", uuid.Nil)
+	}
+
+	log.Printf("Закрыто просроченных активных круговых обменов: %d", len(expired))
+}
+
+// GetCycleTimeline возвращает историю кругового обмена. Историю видят только участники обмена
+func (s *TradeService) GetCycleTimeline(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Пользователь не авторизован"})
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID пользователя"})
+	}
+
+	cycleID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID кругового обмена"})
+	}
+
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	var status string
+	var isParticipant bool
+	err = db.Pool.QueryRow(ctx, `
+        SELECT c.status,
+               EXISTS (SELECT 1 FROM trade_cycle_participants p WHERE p.cycle_id = c.id AND p.user_id = $2)
+        FROM trade_cycles c
+        WHERE c.id = $1
+    `, cycleID, userUUID).Scan(&status, &isParticipant)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Круговой обмен не найден"})
+		}
+		log.Printf("Ошибка запроса кругового обмена: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения кругового обмена"})
+	}
+
+	if !isParticipant {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Вы не участвуете в этом обмене"})
+	}
+
+	events, err := db.GetTradeCycleEvents(ctx, cycleID)
+	if err != nil {
+		log.Printf("Ошибка получения истории кругового обмена: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения истории обмена"})
+	}
+
+	if err := attachEventActors(ctx, events); err != nil {
+		log.Printf("Ошибка получения участников кругового обмена: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения истории обмена"})
+	}
+
+	return c.JSON(fiber.Map{
+		"cycle_id": cycleID,
+		"status":   status,
+		"events":   events,
+	})
+}
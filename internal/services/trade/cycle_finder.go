@@ -0,0 +1,140 @@
+package trade
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/google/uuid"
+
+	"github.com/rajivgeraev/flippy-api/internal/db"
+	"github.com/rajivgeraev/flippy-api/internal/models"
+)
+
+const (
+	// Длина круговых обменов: обмены вдвоем подбирает GetSuggestions,
+	// а договориться больше чем вчетвером на практике сложно
+	minCycleLength = 3
+	maxCycleLength = 4
+
+	// maxWantsPerUser ограничивает ветвление поиска по графу
+	maxWantsPerUser = 20
+)
+
+// wantEdge - ребро графа обменов: пользователь хочет объявление listingID владельца ownerID
+type wantEdge struct {
+	ownerID   uuid.UUID
+	listingID uuid.UUID
+}
+
+// findTradeCycles ищет в графе "пользователь хочет объявление владельца" циклы длиной 3-4.
+// Каждое объявление попадает не больше чем в один найденный цикл, поэтому предложенные
+// обмены не конкурируют друг с другом. wants должны быть отсортированы от свежих к старым
+func findTradeCycles(wants []db.TradeWant, maxCycles int) [][]models.TradeCycleParticipant {
+	// Для каждой пары пользователей оставляем самое свежее желание
+	graph := make(map[uuid.UUID][]wantEdge)
+	seenPairs := make(map[[2]uuid.UUID]bool)
+	for _, want := range wants {
+		pair := [2]uuid.UUID{want.UserID, want.OwnerID}
+		if seenPairs[pair] || len(graph[want.UserID]) >= maxWantsPerUser {
+			continue
+		}
+		seenPairs[pair] = true
+		graph[want.UserID] = append(graph[want.UserID], wantEdge{ownerID: want.OwnerID, listingID: want.ListingID})
+	}
+
+	users := make([]uuid.UUID, 0, len(graph))
+	for userID := range graph {
+		users = append(users, userID)
+	}
+	sort.Slice(users, func(i, j int) bool { return lessID(users[i], users[j]) })
+
+	usedListings := make(map[uuid.UUID]bool)
+	var cycles [][]models.TradeCycleParticipant
+
+	for _, start := range users {
+		for len(cycles) < maxCycles {
+			path := findCycleFrom(graph, start, usedListings)
+			if path == nil {
+				break
+			}
+
+			for _, edge := range path {
+				usedListings[edge.listingID] = true
+			}
+			cycles = append(cycles, cycleParticipants(start, path))
+		}
+
+		if len(cycles) >= maxCycles {
+			break
+		}
+	}
+
+	return cycles
+}
+
+// findCycleFrom ищет в глубину цикл, начинающийся и заканчивающийся в start.
+// Чтобы один цикл не находился из каждого участника, start должен быть наименьшим ID в цикле
+func findCycleFrom(graph map[uuid.UUID][]wantEdge, start uuid.UUID, usedListings map[uuid.UUID]bool) []wantEdge {
+	visited := map[uuid.UUID]bool{start: true}
+	var path []wantEdge
+
+	var dfs func(current uuid.UUID) bool
+	dfs = func(current uuid.UUID) bool {
+		for _, edge := range graph[current] {
+			if usedListings[edge.listingID] {
+				continue
+			}
+
+			if edge.ownerID == start {
+				if len(path)+1 >= minCycleLength {
+					path = append(path, edge)
+					return true
+				}
+				continue
+			}
+
+			if visited[edge.ownerID] || lessID(edge.ownerID, start) || len(path)+1 >= maxCycleLength {
+				continue
+			}
+
+			visited[edge.ownerID] = true
+			path = append(path, edge)
+			if dfs(edge.ownerID) {
+				return true
+			}
+			path = path[:len(path)-1]
+			visited[edge.ownerID] = false
+		}
+		return false
+	}
+
+	if dfs(start) {
+		return path
+	}
+	return nil
+}
+
+// cycleParticipants превращает путь по графу в участников обмена.
+// Ребро path[i] ведет от участника i к участнику i+1: участник i получает объявление участника i+1
+// и отдает свое объявление участнику i-1
+func cycleParticipants(start uuid.UUID, path []wantEdge) []models.TradeCycleParticipant {
+	participants := make([]models.TradeCycleParticipant, len(path))
+	userID := start
+	for i, edge := range path {
+		gives := path[(i+len(path)-1)%len(path)].listingID
+		receives := edge.listingID
+		participants[i] = models.TradeCycleParticipant{
+			UserID:            userID,
+			Position:          i,
+			GivesListingID:    &gives,
+			ReceivesListingID: &receives,
+		}
+		userID = edge.ownerID
+	}
+	return participants
+}
+
+// lessID сравнивает ID в том же порядке, что и PostgreSQL
+func lessID(a, b uuid.UUID) bool {
+	return bytes.Compare(a[:], b[:]) < 0
+}
@@ -0,0 +1,141 @@
+package trade
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/rajivgeraev/flippy-api/internal/db"
+	"github.com/rajivgeraev/flippy-api/internal/models"
+)
+
+// wantGraph строит желания из пар "кто хочет" -> "чье объявление". У каждого пользователя
+// одно объявление, ID которого возвращается в listings
+type wantGraph struct {
+	users    []uuid.UUID
+	listings map[uuid.UUID]uuid.UUID // владелец -> объявление
+}
+
+func newWantGraph(n int) *wantGraph {
+	g := &wantGraph{listings: make(map[uuid.UUID]uuid.UUID)}
+	for i := 0; i < n; i++ {
+		userID := uuid.New()
+		g.users = append(g.users, userID)
+		g.listings[userID] = uuid.New()
+	}
+	return g
+}
+
+// wants возвращает желания по парам индексов пользователей [кто хочет, владелец]
+func (g *wantGraph) wants(edges ...[2]int) []db.TradeWant {
+	wants := make([]db.TradeWant, 0, len(edges))
+	for _, edge := range edges {
+		owner := g.users[edge[1]]
+		wants = append(wants, db.TradeWant{
+			UserID:    g.users[edge[0]],
+			OwnerID:   owner,
+			ListingID: g.listings[owner],
+		})
+	}
+	return wants
+}
+
+// checkCycle проверяет, что каждый участник отдает свое объявление и получает объявление,
+// которое хотел, а отданное им получает предыдущий участник цикла
+func checkCycle(t *testing.T, g *wantGraph, cycle []models.TradeCycleParticipant) {
+	t.Helper()
+
+	if len(cycle) < minCycleLength || len(cycle) > maxCycleLength {
+		t.Fatalf("длина цикла %d вне диапазона %d-%d", len(cycle), minCycleLength, maxCycleLength)
+	}
+
+	seen := make(map[uuid.UUID]bool)
+	for i, p := range cycle {
+		if p.Position != i {
+			t.Fatalf("участник %d имеет позицию %d", i, p.Position)
+		}
+		if seen[p.UserID] {
+			t.Fatalf("пользователь %s входит в цикл дважды", p.UserID)
+		}
+		seen[p.UserID] = true
+
+		if p.GivesListingID == nil || *p.GivesListingID != g.listings[p.UserID] {
+			t.Fatalf("участник %d отдает чужое объявление", i)
+		}
+
+		next := cycle[(i+1)%len(cycle)]
+		if p.ReceivesListingID == nil || *p.ReceivesListingID != g.listings[next.UserID] {
+			t.Fatalf("участник %d получает не объявление следующего участника", i)
+		}
+	}
+}
+
+func TestFindTradeCycles(t *testing.T) {
+	t.Run("цикл из трех", func(t *testing.T) {
+		g := newWantGraph(3)
+		cycles := findTradeCycles(g.wants([2]int{0, 1}, [2]int{1, 2}, [2]int{2, 0}), 10)
+		if len(cycles) != 1 {
+			t.Fatalf("найдено циклов: %d, ожидался 1", len(cycles))
+		}
+		checkCycle(t, g, cycles[0])
+	})
+
+	t.Run("цикл из четырех", func(t *testing.T) {
+		g := newWantGraph(4)
+		cycles := findTradeCycles(g.wants([2]int{0, 1}, [2]int{1, 2}, [2]int{2, 3}, [2]int{3, 0}), 10)
+		if len(cycles) != 1 || len(cycles[0]) != 4 {
+			t.Fatalf("ожидался один цикл из четырех, найдено %d", len(cycles))
+		}
+		checkCycle(t, g, cycles[0])
+	})
+
+	t.Run("обмен вдвоем не цикл", func(t *testing.T) {
+		g := newWantGraph(2)
+		if cycles := findTradeCycles(g.wants([2]int{0, 1}, [2]int{1, 0}), 10); len(cycles) != 0 {
+			t.Fatalf("найдено циклов: %d, ожидалось 0", len(cycles))
+		}
+	})
+
+	t.Run("цикл из пяти слишком длинный", func(t *testing.T) {
+		g := newWantGraph(5)
+		wants := g.wants([2]int{0, 1}, [2]int{1, 2}, [2]int{2, 3}, [2]int{3, 4}, [2]int{4, 0})
+		if cycles := findTradeCycles(wants, 10); len(cycles) != 0 {
+			t.Fatalf("найдено циклов: %d, ожидалось 0", len(cycles))
+		}
+	})
+
+	t.Run("незамкнутая цепочка", func(t *testing.T) {
+		g := newWantGraph(3)
+		if cycles := findTradeCycles(g.wants([2]int{0, 1}, [2]int{1, 2}), 10); len(cycles) != 0 {
+			t.Fatalf("найдено циклов: %d, ожидалось 0", len(cycles))
+		}
+	})
+
+	t.Run("объявление не попадает в два цикла", func(t *testing.T) {
+		// Оба цикла проходят через объявление пользователя 0
+		g := newWantGraph(5)
+		wants := g.wants(
+			[2]int{0, 1}, [2]int{1, 2}, [2]int{2, 0},
+			[2]int{3, 4}, [2]int{4, 0}, [2]int{0, 3},
+		)
+		cycles := findTradeCycles(wants, 10)
+		if len(cycles) != 1 {
+			t.Fatalf("найдено циклов: %d, ожидался 1", len(cycles))
+		}
+		checkCycle(t, g, cycles[0])
+	})
+
+	t.Run("ограничение количества", func(t *testing.T) {
+		g := newWantGraph(6)
+		wants := g.wants(
+			[2]int{0, 1}, [2]int{1, 2}, [2]int{2, 0},
+			[2]int{3, 4}, [2]int{4, 5}, [2]int{5, 3},
+		)
+		if cycles := findTradeCycles(wants, 1); len(cycles) != 1 {
+			t.Fatalf("найдено циклов: %d, ожидался 1", len(cycles))
+		}
+		if cycles := findTradeCycles(wants, 10); len(cycles) != 2 {
+			t.Fatalf("найдено циклов: %d, ожидалось 2", len(cycles))
+		}
+	})
+}
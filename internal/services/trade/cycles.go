@@ -0,0 +1,415 @@
+package trade
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/rajivgeraev/flippy-api/internal/db"
+	"github.com/rajivgeraev/flippy-api/internal/models"
+	"github.com/rajivgeraev/flippy-api/internal/utils"
+	"github.com/rajivgeraev/flippy-api/internal/websocket"
+)
+
+// maxCyclesPerRun ограничивает количество круговых обменов, предлагаемых за один проход
+const maxCyclesPerRun = 100
+
+// StartCycleDiscovery периодически ищет круговые обмены по избранному и предлагает их участникам.
+// Заодно закрываются предложенные обмены, которые не приняли вовремя,
+// и активные обмены, которые никто не подтвердил за срок подтверждения
+func (s *TradeService) StartCycleDiscovery(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			s.expireTradeCycles()
+			s.expireActiveCycles()
+			s.discoverTradeCycles()
+		}
+	}()
+}
+
+// discoverTradeCycles строит граф желаний, находит циклы и сохраняет их как предложения
+func (s *TradeService) discoverTradeCycles() {
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	wants, err := db.GetTradeWants(ctx)
+	if err != nil {
+		log.Printf("Ошибка построения графа обменов: %v", err)
+		return
+	}
+
+	created := 0
+	for _, participants := range findTradeCycles(wants, maxCyclesPerRun) {
+		cycleID, ok, err := db.CreateTradeCycle(ctx, participants)
+		if err != nil {
+			log.Printf("Ошибка сохранения кругового обмена: %v", err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		created++
+		s.notifyCycleUpdate(cycleID, participants, models.TradeCycleStatusProposed,
+			"Найден круговой обмен с объявлением из вашего избранного", uuid.Nil)
+	}
+
+	if created > 0 {
+		log.Printf("Предложено круговых обменов: %d", created)
+	}
+}
+
+// expireTradeCycles закрывает предложенные круговые обмены, которые не приняли за срок ожидания
+func (s *TradeService) expireTradeCycles() {
+	expired, err := db.ExpireTradeCycles(s.cfg.TradeTTL)
+	if err != nil {
+		log.Printf("Ошибка истечения круговых обменов: %v", err)
+		return
+	}
+
+	for cycleID, participants := range expired {
+		s.notifyCycleUpdate(cycleID, participants, models.TradeCycleStatusExpired,
+			"Не все участники приняли круговой обмен вовремя", uuid.Nil)
+	}
+}
+
+// GetMyCycles возвращает круговые обмены, в которых участвует пользователь
+func (s *TradeService) GetMyCycles(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Пользователь не авторизован"})
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID пользователя"})
+	}
+
+	status := c.Query("status", "all") // all, proposed, active, completed, rejected, canceled, expired
+	limit := utils.ParseLimit(c.Query("limit"))
+
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	args := []interface{}{userUUID}
+	statusCondition := ""
+	if status != "all" {
+		args = append(args, status)
+		statusCondition = "AND c.status = $2"
+	}
+	args = append(args, limit)
+
+	rows, err := db.Pool.Query(ctx, fmt.Sprintf(`
+        SELECT c.id, c.status, c.created_at, c.updated_at, c.activated_at, c.completed_at
+        FROM trade_cycles c
+        WHERE EXISTS (SELECT 1 FROM trade_cycle_participants p WHERE p.cycle_id = c.id AND p.user_id = $1) %s
+        ORDER BY c.created_at DESC, c.id DESC
+        LIMIT $%d
+    `, statusCondition, len(args)), args...)
+
+	if err != nil {
+		log.Printf("Ошибка запроса круговых обменов: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения круговых обменов"})
+	}
+	defer rows.Close()
+
+	cycles := []models.TradeCycle{}
+	var cycleIDs []uuid.UUID
+	for rows.Next() {
+		var cycle models.TradeCycle
+		if err := rows.Scan(&cycle.ID, &cycle.Status, &cycle.CreatedAt, &cycle.UpdatedAt, &cycle.ActivatedAt, &cycle.CompletedAt); err != nil {
+			log.Printf("Ошибка сканирования кругового обмена: %v", err)
+			continue
+		}
+		cycles = append(cycles, cycle)
+		cycleIDs = append(cycleIDs, cycle.ID)
+	}
+	rows.Close()
+
+	if err := s.attachCycleDetails(ctx, cycles, cycleIDs); err != nil {
+		log.Printf("Ошибка загрузки участников круговых обменов: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения круговых обменов"})
+	}
+
+	return c.JSON(fiber.Map{
+		"cycles": cycles,
+		"count":  len(cycles),
+		"limit":  limit,
+	})
+}
+
+// AcceptCycle фиксирует согласие участника на круговой обмен.
+// Когда согласны все, обмен становится активным, а объявления резервируются
+func (s *TradeService) AcceptCycle(c fiber.Ctx) error {
+	return s.respondToCycle(c, true)
+}
+
+// RejectCycle отклоняет круговой обмен для всех участников
+func (s *TradeService) RejectCycle(c fiber.Ctx) error {
+	return s.respondToCycle(c, false)
+}
+
+// respondToCycle обрабатывает ответ участника на предложенный круговой обмен
+func (s *TradeService) respondToCycle(c fiber.Ctx, accept bool) error {
+	userID := c.Locals("userID").(string)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Пользователь не авторизован"})
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID пользователя"})
+	}
+
+	cycleID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID кругового обмена"})
+	}
+
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		log.Printf("Ошибка начала транзакции: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка базы данных"})
+	}
+	defer tx.Rollback(ctx)
+
+	status, isParticipant, err := lockCycle(ctx, tx, cycleID, userUUID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Круговой обмен не найден"})
+		}
+		log.Printf("Ошибка запроса кругового обмена: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения кругового обмена"})
+	}
+
+	if !isParticipant {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Вы не участвуете в этом обмене"})
+	}
+
+	if status != models.TradeCycleStatusProposed {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Круговой обмен уже не ожидает ответа"})
+	}
+
+	newStatus := models.TradeCycleStatusRejected
+	reason := "Один из участников отказался от кругового обмена"
+	var superseded []supersededTrade
+
+	if accept {
+		newStatus, reason, superseded, err = acceptCycle(ctx, tx, cycleID, userUUID)
+		if err != nil {
+			log.Printf("Ошибка принятия кругового обмена: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка обновления кругового обмена"})
+		}
+	}
+
+	if newStatus != status {
+		_, err = tx.Exec(ctx, `
+            UPDATE trade_cycles SET status = $1, updated_at = NOW() WHERE id = $2
+        `, newStatus, cycleID)
+
+		if err != nil {
+			log.Printf("Ошибка обновления кругового обмена: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка обновления кругового обмена"})
+		}
+	}
+
+	if err = recordCycleResponse(ctx, tx, cycleID, userUUID, accept, newStatus, reason); err != nil {
+		log.Printf("Ошибка записи истории кругового обмена: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка обновления кругового обмена"})
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		log.Printf("Ошибка фиксации транзакции: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка базы данных"})
+	}
+
+	participants, err := db.GetTradeCycleParticipants(ctx, []uuid.UUID{cycleID})
+	if err != nil {
+		log.Printf("Ошибка получения участников кругового обмена: %v", err)
+	} else if newStatus != status {
+		s.notifyCycleUpdate(cycleID, participants[cycleID], newStatus, reason, userUUID)
+	}
+
+	for _, t := range superseded {
+		for _, participantID := range []uuid.UUID{t.SenderID, t.ReceiverID} {
+			s.notifyTradeUpdate(participantID, t.ID, tradeStatusSuperseded, supersededByCycleReason)
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"success":      true,
+		"cycle_id":     cycleID,
+		"status":       newStatus,
+		"participants": participants[cycleID],
+	})
+}
+
+// lockCycle блокирует круговой обмен, чтобы действия участников обрабатывались по очереди,
+// и проверяет, участвует ли в нем пользователь
+func lockCycle(ctx context.Context, tx pgx.Tx, cycleID, userID uuid.UUID) (string, bool, error) {
+	var status string
+	var isParticipant bool
+	err := tx.QueryRow(ctx, `
+        SELECT c.status,
+               EXISTS (SELECT 1 FROM trade_cycle_participants p WHERE p.cycle_id = c.id AND p.user_id = $2)
+        FROM trade_cycles c
+        WHERE c.id = $1
+        FOR UPDATE OF c
+    `, cycleID, userID).Scan(&status, &isParticipant)
+
+	return status, isParticipant, err
+}
+
+// recordCycleResponse записывает в историю ответ участника и, если обмен отменился из-за
+// недоступного объявления, автоматическую отмену
+func recordCycleResponse(ctx context.Context, tx pgx.Tx, cycleID, userID uuid.UUID, accept bool, newStatus, reason string) error {
+	if !accept {
+		return db.RecordTradeCycleEvent(ctx, tx, cycleID, models.TradeEventRejected, &userID, nil)
+	}
+
+	if err := db.RecordTradeCycleEvent(ctx, tx, cycleID, models.TradeEventAccepted, &userID, nil); err != nil {
+		return err
+	}
+
+	if newStatus == models.TradeCycleStatusCanceled {
+		return db.RecordTradeCycleEvent(ctx, tx, cycleID, models.TradeEventCanceled, nil, map[string]string{"reason": reason})
+	}
+
+	return nil
+}
+
+// acceptCycle отмечает согласие участника и, если согласны все, резервирует объявления цикла
+// и создает чаты между соседними участниками. Если какое-то объявление уже недоступно, обмен отменяется
+func acceptCycle(ctx context.Context, tx pgx.Tx, cycleID, userID uuid.UUID) (string, string, []supersededTrade, error) {
+	_, err := tx.Exec(ctx, `
+        UPDATE trade_cycle_participants
+        SET accepted_at = COALESCE(accepted_at, NOW())
+        WHERE cycle_id = $1 AND user_id = $2
+    `, cycleID, userID)
+
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	var waiting int
+	var listingIDs []uuid.UUID
+	err = tx.QueryRow(ctx, `
+        SELECT COUNT(*) FILTER (WHERE accepted_at IS NULL), array_agg(gives_listing_id) FILTER (WHERE gives_listing_id IS NOT NULL)
+        FROM trade_cycle_participants
+        WHERE cycle_id = $1
+    `, cycleID).Scan(&waiting, &listingIDs)
+
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	if waiting > 0 {
+		return models.TradeCycleStatusProposed, "", nil, nil
+	}
+
+	err = db.SetListingsStatus(ctx, tx, listingIDs, models.ListingStatusReserved)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidListingTransition) || err == pgx.ErrNoRows {
+			return models.TradeCycleStatusCanceled, "Одно из объявлений больше не доступно для обмена", nil, nil
+		}
+		return "", "", nil, err
+	}
+
+	// Ожидающие обычные предложения с этими объявлениями закрываются, как при принятии обмена
+	superseded, err := supersedeConflictingTrades(ctx, tx, uuid.Nil, listingIDs, supersededByCycleReason, nil)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	// С момента активации отсчитывается срок на подтверждение обмена
+	_, err = tx.Exec(ctx, `
+        UPDATE trade_cycles SET activated_at = NOW() WHERE id = $1
+    `, cycleID)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	if err := db.CreateTradeCycleChats(ctx, tx, cycleID); err != nil {
+		return "", "", nil, err
+	}
+
+	return models.TradeCycleStatusActive, "Все участники приняли круговой обмен", superseded, nil
+}
+
+// attachCycleDetails загружает участников, пользователей и объявления круговых обменов
+func (s *TradeService) attachCycleDetails(ctx context.Context, cycles []models.TradeCycle, cycleIDs []uuid.UUID) error {
+	participants, err := db.GetTradeCycleParticipants(ctx, cycleIDs)
+	if err != nil {
+		return err
+	}
+
+	var userIDs, listingIDs []uuid.UUID
+	for _, list := range participants {
+		for _, p := range list {
+			userIDs = append(userIDs, p.UserID)
+			if p.GivesListingID != nil {
+				listingIDs = append(listingIDs, *p.GivesListingID)
+			}
+		}
+	}
+
+	users, err := db.GetUsersInfo(ctx, userIDs)
+	if err != nil {
+		return err
+	}
+
+	listings, err := db.GetListingsByIDs(ctx, listingIDs)
+	if err != nil {
+		return err
+	}
+
+	for i := range cycles {
+		list := participants[cycles[i].ID]
+		for j := range list {
+			list[j].User = users[list[j].UserID]
+			if list[j].GivesListingID != nil {
+				list[j].GivesListing = listings[*list[j].GivesListingID]
+			}
+			if list[j].ReceivesListingID != nil {
+				list[j].ReceivesListing = listings[*list[j].ReceivesListingID]
+			}
+		}
+		cycles[i].Participants = list
+	}
+
+	return nil
+}
+
+// notifyCycleUpdate сообщает участникам кругового обмена об изменении его статуса
+func (s *TradeService) notifyCycleUpdate(cycleID uuid.UUID, participants []models.TradeCycleParticipant, status, reason string, excludeUserID uuid.UUID) {
+	payload, _ := json.Marshal(map[string]string{
+		"cycle_id": cycleID.String(),
+		"status":   status,
+		"reason":   reason,
+	})
+
+	for _, p := range participants {
+		if p.UserID == excludeUserID {
+			continue
+		}
+
+		s.wsManager.SendToUser(p.UserID.String(), websocket.Event{
+			Type:      websocket.EventTradeCycleUpdated,
+			Timestamp: time.Now(),
+			Payload:   payload,
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package trade
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/rajivgeraev/flippy-api/internal/db"
+	"github.com/rajivgeraev/flippy-api/internal/websocket"
+)
+
+// Статус предложения, на которое не ответили за отведенный срок
+const tradeStatusExpired = "expired"
+
+// StartExpirationScheduler периодически напоминает получателям о предложениях, срок которых скоро истечет,
+// и переводит просроченные ожидающие предложения в статус expired
+func (s *TradeService) StartExpirationScheduler(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			s.sendExpirationReminders()
+			s.expirePendingTrades()
+		}
+	}()
+}
+
+// sendExpirationReminders напоминает получателям о предложениях, которые скоро истекут.
+// Напоминания уже сохранены в уведомлениях, по WebSocket они сразу доходят до тех, кто в сети
+func (s *TradeService) sendExpirationReminders() {
+	trades, err := db.MarkTradesForReminder(s.cfg.TradeTTL, s.cfg.TradeReminderBefore)
+	if err != nil {
+		log.Printf("Ошибка отбора предложений для напоминания: %v", err)
+		return
+	}
+
+	for _, trade := range trades {
+		s.sendTradeReminder(trade.ReceiverID, trade.ID, trade.CreatedAt.Add(s.cfg.TradeTTL))
+	}
+}
+
+// expirePendingTrades закрывает просроченные предложения и оповещает обе стороны
+func (s *TradeService) expirePendingTrades() {
+	reason := "Срок ответа на предложение истек"
+	trades, err := db.ExpirePendingTrades(s.cfg.TradeTTL, reason)
+	if err != nil {
+		log.Printf("Ошибка истечения срока предложений: %v", err)
+		return
+	}
+
+	for _, trade := range trades {
+		s.notifyTradeUpdate(trade.SenderID, trade.ID, tradeStatusExpired, reason)
+		s.notifyTradeUpdate(trade.ReceiverID, trade.ID, tradeStatusExpired, reason)
+	}
+
+	if len(trades) > 0 {
+		log.Printf("Истек срок %d предложений обмена", len(trades))
+	}
+}
+
+// sendTradeReminder напоминает получателю, что предложение скоро истечет
+func (s *TradeService) sendTradeReminder(userID, tradeID uuid.UUID, expiresAt time.Time) {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"trade_id":   tradeID.String(),
+		"expires_at": expiresAt,
+	})
+
+	s.wsManager.SendToUser(userID.String(), websocket.Event{
+		Type:      websocket.EventTradeReminder,
+		Timestamp: time.Now(),
+		Payload:   payload,
+	})
+}
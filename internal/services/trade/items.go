@@ -0,0 +1,139 @@
+package trade
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/rajivgeraev/flippy-api/internal/models"
+)
+
+// maxTradeItemsPerSide ограничивает количество объявлений с одной стороны обмена
+const maxTradeItemsPerSide = 10
+
+// parseListingIDs объединяет одиночный ID и список ID объявлений одной стороны обмена.
+// Одиночное поле оставлено для клиентов, которые предлагают обмен один на один
+func parseListingIDs(single string, many []string) ([]uuid.UUID, error) {
+	raw := many
+	if single != "" {
+		raw = append([]string{single}, many...)
+	}
+
+	seen := make(map[uuid.UUID]bool, len(raw))
+	listingIDs := make([]uuid.UUID, 0, len(raw))
+	for _, value := range raw {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("неверный формат ID объявления: %s", value)
+		}
+		if !seen[id] {
+			seen[id] = true
+			listingIDs = append(listingIDs, id)
+		}
+	}
+
+	if len(listingIDs) > maxTradeItemsPerSide {
+		return nil, fmt.Errorf("с одной стороны обмена можно указать не более %d объявлений", maxTradeItemsPerSide)
+	}
+
+	return listingIDs, nil
+}
+
+// validateTradeSides проверяет объявления обеих сторон обмена: объявления отправителя принадлежат ему,
+// запрашиваемые объявления принадлежат одному другому пользователю, и все они активны.
+// Возвращает ID получателя
+func validateTradeSides(ctx context.Context, tx pgx.Tx, senderID uuid.UUID, senderListingIDs, receiverListingIDs []uuid.UUID) (uuid.UUID, *fiber.Error) {
+	if len(senderListingIDs) == 0 || len(receiverListingIDs) == 0 {
+		return uuid.Nil, fiber.NewError(fiber.StatusBadRequest, "Необходимо указать ID объявлений для обмена")
+	}
+
+	type tradeListing struct {
+		ownerID uuid.UUID
+		status  string
+	}
+
+	listingIDs := append(append([]uuid.UUID{}, senderListingIDs...), receiverListingIDs...)
+	rows, err := tx.Query(ctx, `
+        SELECT id, user_id, status FROM listings WHERE id = ANY($1)
+    `, listingIDs)
+
+	if err != nil {
+		log.Printf("Ошибка запроса объявлений обмена: %v", err)
+		return uuid.Nil, fiber.NewError(fiber.StatusInternalServerError, "Ошибка проверки объявления")
+	}
+
+	listings := make(map[uuid.UUID]tradeListing, len(listingIDs))
+	for rows.Next() {
+		var id uuid.UUID
+		var listing tradeListing
+		if err := rows.Scan(&id, &listing.ownerID, &listing.status); err != nil {
+			rows.Close()
+			log.Printf("Ошибка сканирования объявления обмена: %v", err)
+			return uuid.Nil, fiber.NewError(fiber.StatusInternalServerError, "Ошибка проверки объявления")
+		}
+		listings[id] = listing
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Ошибка чтения объявлений обмена: %v", err)
+		return uuid.Nil, fiber.NewError(fiber.StatusInternalServerError, "Ошибка проверки объявления")
+	}
+
+	for _, id := range senderListingIDs {
+		listing, ok := listings[id]
+		if !ok {
+			return uuid.Nil, fiber.NewError(fiber.StatusNotFound, "Объявление отправителя не найдено")
+		}
+		if listing.ownerID != senderID {
+			return uuid.Nil, fiber.NewError(fiber.StatusForbidden, "Вы не можете предложить чужое объявление для обмена")
+		}
+	}
+
+	receiverID := uuid.Nil
+	for _, id := range receiverListingIDs {
+		listing, ok := listings[id]
+		if !ok {
+			return uuid.Nil, fiber.NewError(fiber.StatusNotFound, "Объявление получателя не найдено")
+		}
+		if listing.ownerID == senderID {
+			return uuid.Nil, fiber.NewError(fiber.StatusBadRequest, "Вы не можете предложить обмен самому себе")
+		}
+		if receiverID == uuid.Nil {
+			receiverID = listing.ownerID
+		} else if listing.ownerID != receiverID {
+			return uuid.Nil, fiber.NewError(fiber.StatusBadRequest, "Все запрашиваемые объявления должны принадлежать одному пользователю")
+		}
+	}
+
+	// Обмениваться можно только активными объявлениями
+	for _, listing := range listings {
+		if listing.status != models.ListingStatusActive {
+			return uuid.Nil, fiber.NewError(fiber.StatusConflict, "Обмен возможен только для активных объявлений")
+		}
+	}
+
+	return receiverID, nil
+}
+
+// sameListingIDs проверяет, что наборы объявлений совпадают без учета порядка
+func sameListingIDs(a, b []uuid.UUID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	set := make(map[uuid.UUID]bool, len(a))
+	for _, id := range a {
+		set[id] = true
+	}
+	for _, id := range b {
+		if !set[id] {
+			return false
+		}
+	}
+	return true
+}
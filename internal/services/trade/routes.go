@@ -19,6 +19,26 @@ func (s *TradeService) SetupRoutes(app *fiber.App) {
 	// Маршрут для получения списка предложений обмена
 	api.Get("/", s.GetMyTrades)
 
+	// Маршрут для подбора взаимных обменов по избранному
+	api.Get("/suggestions", s.GetSuggestions)
+
+	// Маршруты для круговых обменов между несколькими пользователями
+	api.Get("/cycles", s.GetMyCycles)
+	api.Post("/cycles/:id/accept", s.AcceptCycle)
+	api.Post("/cycles/:id/reject", s.RejectCycle)
+	api.Post("/cycles/:id/confirm", s.ConfirmCycle)
+	api.Post("/cycles/:id/cancel", s.CancelCycle)
+	api.Get("/cycles/:id/timeline", s.GetCycleTimeline)
+
 	// Маршрут для обновления статуса предложения обмена
 	api.Put("/:id/status", s.UpdateTradeStatus)
+
+	// Маршрут для встречного предложения
+	api.Post("/:id/counter", s.CounterTrade)
+
+	// Маршрут для подтверждения того, что обмен состоялся
+	api.Post("/:id/confirm", s.ConfirmTrade)
+
+	// Маршрут для получения истории обмена
+	api.Get("/:id/timeline", s.GetTradeTimeline)
 }
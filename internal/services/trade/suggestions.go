@@ -0,0 +1,172 @@
+package trade
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+
+	"github.com/rajivgeraev/flippy-api/internal/db"
+	"github.com/rajivgeraev/flippy-api/internal/models"
+	"github.com/rajivgeraev/flippy-api/internal/utils"
+)
+
+// suggestionFreshnessHours - за сколько часов вес взаимного интереса уменьшается вдвое
+const suggestionFreshnessHours = 168
+
+// tradeRequest повторяет тело запроса CreateTrade, чтобы клиент мог сразу предложить обмен
+type tradeRequest struct {
+	SenderListingIDs   []uuid.UUID `json:"sender_listing_ids"`
+	ReceiverListingIDs []uuid.UUID `json:"receiver_listing_ids"`
+}
+
+// tradeSuggestion описывает пользователя, с которым возможен взаимный обмен
+type tradeSuggestion struct {
+	User           *models.User      `json:"user"`
+	Score          float64           `json:"score"`
+	LastInterestAt time.Time         `json:"last_interest_at"`
+	MyListings     []*models.Listing `json:"my_listings"`    // Мои объявления в избранном у пользователя
+	TheirListings  []*models.Listing `json:"their_listings"` // Объявления пользователя в моем избранном
+	TradeRequest   tradeRequest      `json:"trade_request"`
+}
+
+// GetSuggestions подбирает пользователей, которые добавили в избранное мои объявления
+// и при этом владеют объявлениями из моего избранного.
+// Чем больше взаимного интереса и чем он свежее, тем выше предложение в списке
+func (s *TradeService) GetSuggestions(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Пользователь не авторизован"})
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID пользователя"})
+	}
+
+	limit := utils.ParseLimit(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.Query("offset", "0"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	// Учитываются только активные объявления, доступные для обмена.
+	// Пользователи, с которыми уже идет обмен, не предлагаются
+	rows, err := db.Pool.Query(ctx, `
+        WITH wanted_by_me AS (
+            SELECT l.id, l.user_id AS partner_id, GREATEST(f.created_at, l.updated_at) AS active_at
+            FROM favorites f
+            JOIN listings l ON l.id = f.listing_id
+            WHERE f.user_id = $1 AND l.user_id != $1
+              AND l.status = 'active' AND l.allow_trade = true
+        ),
+        wanted_from_me AS (
+            SELECT l.id, f.user_id AS partner_id, GREATEST(f.created_at, l.updated_at) AS active_at
+            FROM favorites f
+            JOIN listings l ON l.id = f.listing_id
+            WHERE l.user_id = $1 AND f.user_id != $1
+              AND l.status = 'active' AND l.allow_trade = true
+        ),
+        matches AS (
+            SELECT t.partner_id,
+                   t.listing_ids AS their_listing_ids,
+                   m.listing_ids AS my_listing_ids,
+                   GREATEST(t.active_at, m.active_at) AS last_interest_at
+            FROM (SELECT partner_id, array_agg(id ORDER BY active_at DESC) AS listing_ids, MAX(active_at) AS active_at
+                  FROM wanted_by_me GROUP BY partner_id) t
+            JOIN (SELECT partner_id, array_agg(id ORDER BY active_at DESC) AS listing_ids, MAX(active_at) AS active_at
+                  FROM wanted_from_me GROUP BY partner_id) m ON m.partner_id = t.partner_id
+            WHERE NOT EXISTS (
+                SELECT 1 FROM trades tr
+                WHERE tr.status IN ('pending', 'accepted')
+                  AND ((tr.sender_id = $1 AND tr.receiver_id = t.partner_id)
+                    OR (tr.sender_id = t.partner_id AND tr.receiver_id = $1))
+            )
+        )
+        SELECT partner_id, their_listing_ids, my_listing_ids, last_interest_at,
+               (LEAST(cardinality(their_listing_ids), cardinality(my_listing_ids)) * 2
+                   + cardinality(their_listing_ids) + cardinality(my_listing_ids))::float8
+               / power(2.0, EXTRACT(EPOCH FROM NOW() - last_interest_at)::float8 / 3600 / $2::float8) AS score
+        FROM matches
+        ORDER BY score DESC, last_interest_at DESC, partner_id
+        LIMIT $3 OFFSET $4
+    `, userUUID, suggestionFreshnessHours, limit, offset)
+
+	if err != nil {
+		log.Printf("Ошибка подбора обменов: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка подбора обменов"})
+	}
+	defer rows.Close()
+
+	type match struct {
+		partnerID       uuid.UUID
+		theirListingIDs []uuid.UUID
+		myListingIDs    []uuid.UUID
+		lastInterestAt  time.Time
+		score           float64
+	}
+
+	var matches []match
+	var partnerIDs, listingIDs []uuid.UUID
+	for rows.Next() {
+		var m match
+		if err := rows.Scan(&m.partnerID, &m.theirListingIDs, &m.myListingIDs, &m.lastInterestAt, &m.score); err != nil {
+			log.Printf("Ошибка сканирования предложения: %v", err)
+			continue
+		}
+
+		matches = append(matches, m)
+		partnerIDs = append(partnerIDs, m.partnerID)
+		listingIDs = append(listingIDs, m.theirListingIDs...)
+		listingIDs = append(listingIDs, m.myListingIDs...)
+	}
+	rows.Close()
+
+	// Пользователи и объявления всех предложений загружаются пакетно
+	users, err := db.GetUsersInfo(ctx, partnerIDs)
+	if err != nil {
+		log.Printf("Ошибка получения пользователей: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка подбора обменов"})
+	}
+
+	listings, err := db.GetListingsByIDs(ctx, listingIDs)
+	if err != nil {
+		log.Printf("Ошибка получения объявлений: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка подбора обменов"})
+	}
+
+	suggestions := make([]tradeSuggestion, 0, len(matches))
+	for _, m := range matches {
+		suggestions = append(suggestions, tradeSuggestion{
+			User:           users[m.partnerID],
+			Score:          m.score,
+			LastInterestAt: m.lastInterestAt,
+			MyListings:     db.PickListings(listings, m.myListingIDs),
+			TheirListings:  db.PickListings(listings, m.theirListingIDs),
+			TradeRequest: tradeRequest{
+				SenderListingIDs:   firstListingIDs(m.myListingIDs, maxTradeItemsPerSide),
+				ReceiverListingIDs: firstListingIDs(m.theirListingIDs, maxTradeItemsPerSide),
+			},
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"suggestions": suggestions,
+		"count":       len(suggestions),
+		"limit":       limit,
+		"offset":      offset,
+	})
+}
+
+// firstListingIDs возвращает не больше n первых ID
+func firstListingIDs(listingIDs []uuid.UUID, n int) []uuid.UUID {
+	if len(listingIDs) > n {
+		return listingIDs[:n]
+	}
+	return listingIDs
+}
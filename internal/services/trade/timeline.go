@@ -0,0 +1,94 @@
+package trade
+
+import (
+	"context"
+	"log"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/rajivgeraev/flippy-api/internal/db"
+	"github.com/rajivgeraev/flippy-api/internal/models"
+)
+
+// GetTradeTimeline возвращает историю обмена: кто и когда его создал, принял, отклонил, отменил или завершил.
+// Историю видят только участники обмена
+func (s *TradeService) GetTradeTimeline(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Пользователь не авторизован"})
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID пользователя"})
+	}
+
+	tradeUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID предложения обмена"})
+	}
+
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	var senderID, receiverID uuid.UUID
+	var status string
+	var parentTradeID *uuid.UUID
+	err = db.Pool.QueryRow(ctx, `
+        SELECT sender_id, receiver_id, status, parent_trade_id FROM trades WHERE id = $1
+    `, tradeUUID).Scan(&senderID, &receiverID, &status, &parentTradeID)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Предложение обмена не найдено"})
+		}
+		log.Printf("Ошибка запроса предложения обмена: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения предложения обмена"})
+	}
+
+	if userUUID != senderID && userUUID != receiverID {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Вы не участвуете в этом обмене"})
+	}
+
+	events, err := db.GetTradeEvents(ctx, tradeUUID)
+	if err != nil {
+		log.Printf("Ошибка получения истории обмена: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения истории обмена"})
+	}
+
+	if err := attachEventActors(ctx, events); err != nil {
+		log.Printf("Ошибка получения участников обмена: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения истории обмена"})
+	}
+
+	return c.JSON(fiber.Map{
+		"trade_id":        tradeUUID,
+		"status":          status,
+		"parent_trade_id": parentTradeID,
+		"events":          events,
+	})
+}
+
+// attachEventActors загружает авторов событий истории одним запросом
+func attachEventActors(ctx context.Context, events []models.TradeEvent) error {
+	var actorIDs []uuid.UUID
+	for _, event := range events {
+		if event.ActorID != nil {
+			actorIDs = append(actorIDs, *event.ActorID)
+		}
+	}
+
+	actors, err := db.GetUsersInfo(ctx, actorIDs)
+	if err != nil {
+		return err
+	}
+	for i := range events {
+		if events[i].ActorID != nil {
+			events[i].Actor = actors[*events[i].ActorID]
+		}
+	}
+
+	return nil
+}
@@ -3,7 +3,11 @@ package trade
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v3"
@@ -14,22 +18,41 @@ import (
 	"github.com/rajivgeraev/flippy-api/internal/db"
 	"github.com/rajivgeraev/flippy-api/internal/models"
 	"github.com/rajivgeraev/flippy-api/internal/utils"
+	"github.com/rajivgeraev/flippy-api/internal/websocket"
+)
+
+// Статус предложения, вытесненного принятием другого обмена с теми же объявлениями
+const tradeStatusSuperseded = "superseded"
+
+// Причины закрытия вытесненных предложений, которые видят их участники
+const (
+	supersededByTradeReason = "Объявление уже участвует в другом принятом обмене"
+	supersededByCycleReason = "Объявление уже участвует в круговом обмене"
 )
 
 // TradeService представляет сервис для работы с обменами
 type TradeService struct {
 	cfg        *config.Config
 	jwtService *utils.JWTService
+	wsManager  *websocket.Manager
 }
 
 // NewTradeService создает новый экземпляр TradeService
-func NewTradeService(cfg *config.Config) *TradeService {
+func NewTradeService(cfg *config.Config, wsManager *websocket.Manager) *TradeService {
 	return &TradeService{
 		cfg:        cfg,
-		jwtService: utils.NewJWTService(cfg.JWTSecret),
+		jwtService: utils.NewJWTService(cfg.JWT),
+		wsManager:  wsManager,
 	}
 }
 
+// supersededTrade описывает предложение, автоматически закрытое при принятии другого обмена
+type supersededTrade struct {
+	ID         uuid.UUID
+	SenderID   uuid.UUID
+	ReceiverID uuid.UUID
+}
+
 // CreateTrade создает новое предложение обмена
 func (s *TradeService) CreateTrade(c fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
@@ -43,11 +66,14 @@ func (s *TradeService) CreateTrade(c fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID пользователя"})
 	}
 
-	// Извлекаем данные из запроса
+	// Извлекаем данные из запроса. С каждой стороны можно указать одно объявление
+	// или несколько через *_listing_ids
 	var requestData struct {
-		ReceiverListingID string `json:"receiver_listing_id"`
-		SenderListingID   string `json:"sender_listing_id"`
-		Message           string `json:"message"`
+		ReceiverListingID  string   `json:"receiver_listing_id"`
+		SenderListingID    string   `json:"sender_listing_id"`
+		ReceiverListingIDs []string `json:"receiver_listing_ids"`
+		SenderListingIDs   []string `json:"sender_listing_ids"`
+		Message            string   `json:"message"`
 	}
 
 	if err := c.Bind().Body(&requestData); err != nil {
@@ -55,101 +81,74 @@ func (s *TradeService) CreateTrade(c fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат данных"})
 	}
 
-	// Проверка обязательных полей
-	if requestData.ReceiverListingID == "" || requestData.SenderListingID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Необходимо указать ID объявлений для обмена"})
-	}
-
 	// Преобразуем ID в UUID
-	receiverListingID, err := uuid.Parse(requestData.ReceiverListingID)
+	senderListingIDs, err := parseListingIDs(requestData.SenderListingID, requestData.SenderListingIDs)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID объявления получателя"})
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	senderListingID, err := uuid.Parse(requestData.SenderListingID)
+	receiverListingIDs, err := parseListingIDs(requestData.ReceiverListingID, requestData.ReceiverListingIDs)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный формат ID объявления отправителя"})
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	// Получаем контекст для работы с БД
 	ctx, cancel := db.GetContext()
 	defer cancel()
 
-	// Проверяем, что объявление отправителя принадлежит ему
-	var senderListingOwnerID uuid.UUID
-	err = db.Pool.QueryRow(ctx, `
-        SELECT user_id FROM listings WHERE id = $1
-    `, senderListingID).Scan(&senderListingOwnerID)
-
-	if err != nil {
-		if err == pgx.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Объявление отправителя не найдено"})
-		}
-		log.Printf("Ошибка запроса объявления отправителя: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка проверки объявления"})
-	}
-
-	if senderListingOwnerID != senderID {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Вы не можете предложить чужое объявление для обмена"})
-	}
-
-	// Получаем ID владельца объявления получателя
-	var receiverID uuid.UUID
-	err = db.Pool.QueryRow(ctx, `
-        SELECT user_id FROM listings WHERE id = $1
-    `, receiverListingID).Scan(&receiverID)
-
+	// Начинаем транзакцию
+	tx, err := db.Pool.Begin(ctx)
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Объявление получателя не найдено"})
-		}
-		log.Printf("Ошибка запроса объявления получателя: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка проверки объявления"})
+		log.Printf("Ошибка начала транзакции: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка базы данных"})
 	}
+	defer tx.Rollback(ctx)
 
-	// Проверяем, что пользователь не предлагает обмен самому себе
-	if receiverID == senderID {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Вы не можете предложить обмен самому себе"})
+	// Проверяем владельцев и статусы объявлений обеих сторон
+	receiverID, e := validateTradeSides(ctx, tx, senderID, senderListingIDs, receiverListingIDs)
+	if e != nil {
+		return c.Status(e.Code).JSON(fiber.Map{"error": e.Message})
 	}
 
 	// Проверяем, не существует ли уже предложение обмена с такими же объявлениями
-	var existingTradeCount int
-	err = db.Pool.QueryRow(ctx, `
-        SELECT COUNT(*) FROM trades 
-        WHERE sender_listing_id = $1 AND receiver_listing_id = $2 AND status = 'pending'
-    `, senderListingID, receiverListingID).Scan(&existingTradeCount)
-
+	exists, err := db.PendingTradeExists(ctx, tx, senderID, senderListingIDs, receiverListingIDs)
 	if err != nil {
 		log.Printf("Ошибка проверки существующих предложений: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка проверки существующих обменов"})
 	}
 
-	if existingTradeCount > 0 {
+	if exists {
 		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Такое предложение обмена уже существует"})
 	}
 
-	// Начинаем транзакцию
-	tx, err := db.Pool.Begin(ctx)
-	if err != nil {
-		log.Printf("Ошибка начала транзакции: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка базы данных"})
-	}
-	defer tx.Rollback(ctx)
-
 	// Создаем ID для нового предложения обмена
 	tradeID := uuid.New()
 
-	// Вставляем предложение обмена
+	// Вставляем предложение обмена. В самой записи хранится первое объявление каждой стороны
 	_, err = tx.Exec(ctx, `
         INSERT INTO trades (id, sender_id, receiver_id, sender_listing_id, receiver_listing_id, status, message)
         VALUES ($1, $2, $3, $4, $5, 'pending', $6)
-    `, tradeID, senderID, receiverID, senderListingID, receiverListingID, requestData.Message)
+    `, tradeID, senderID, receiverID, senderListingIDs[0], receiverListingIDs[0], requestData.Message)
 
 	if err != nil {
 		log.Printf("Ошибка создания предложения обмена: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка сохранения предложения обмена"})
 	}
 
+	if err = db.CreateTradeItems(ctx, tx, tradeID, senderListingIDs, receiverListingIDs); err != nil {
+		log.Printf("Ошибка сохранения объявлений обмена: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка сохранения предложения обмена"})
+	}
+
+	err = db.RecordTradeEvent(ctx, tx, tradeID, models.TradeEventCreated, &senderID, map[string]interface{}{
+		"sender_listing_ids":   senderListingIDs,
+		"receiver_listing_ids": receiverListingIDs,
+	})
+	if err != nil {
+		log.Printf("Ошибка записи истории обмена: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка сохранения предложения обмена"})
+	}
+
 	// Фиксируем транзакцию
 	if err = tx.Commit(ctx); err != nil {
 		log.Printf("Ошибка фиксации транзакции: %v", err)
@@ -178,78 +177,70 @@ func (s *TradeService) GetMyTrades(c fiber.Ctx) error {
 
 	// Получаем тип предложений (входящие/исходящие/все)
 	tradeType := c.Query("type", "all") // all, incoming, outgoing
-	status := c.Query("status", "all")  // all, pending, accepted, rejected
+	status := c.Query("status", "all")  // all, pending, accepted, completed, rejected, countered, expired
+
+	// Параметры пагинации: курсор имеет приоритет над смещением.
+	// Без limit и cursor возвращаются все обмены, как до появления пагинации
+	paginate := c.Query("limit") != "" || c.Query("cursor") != ""
+	limit := utils.ParseLimit(c.Query("limit"))
+	offsetStr := c.Query("offset", "0")
+	offset, _ := strconv.Atoi(offsetStr)
+
+	var cursor *utils.Cursor
+	if cursorStr := c.Query("cursor"); cursorStr != "" {
+		if cursor, err = utils.DecodeCursor(cursorStr); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Неверный курсор"})
+		}
+		offset = 0
+	}
 
 	// Получаем контекст для работы с БД
 	ctx, cancel := db.GetContext()
 	defer cancel()
 
-	// Формируем базовый запрос в зависимости от типа и статуса
-	var query string
-	var args []interface{}
-
-	if tradeType == "incoming" {
-		if status == "all" {
-			query = `
-                SELECT t.id, t.sender_id, t.receiver_id, t.sender_listing_id, t.receiver_listing_id,
-                       t.status, t.message, t.created_at, t.updated_at
-                FROM trades t
-                WHERE t.receiver_id = $1
-                ORDER BY t.created_at DESC
-            `
-			args = []interface{}{userUUID}
-		} else {
-			query = `
-                SELECT t.id, t.sender_id, t.receiver_id, t.sender_listing_id, t.receiver_listing_id,
-                       t.status, t.message, t.created_at, t.updated_at
-                FROM trades t
-                WHERE t.receiver_id = $1 AND t.status = $2
-                ORDER BY t.created_at DESC
-            `
-			args = []interface{}{userUUID, status}
-		}
-	} else if tradeType == "outgoing" {
-		if status == "all" {
-			query = `
-                SELECT t.id, t.sender_id, t.receiver_id, t.sender_listing_id, t.receiver_listing_id,
-                       t.status, t.message, t.created_at, t.updated_at
-                FROM trades t
-                WHERE t.sender_id = $1
-                ORDER BY t.created_at DESC
-            `
-			args = []interface{}{userUUID}
-		} else {
-			query = `
-                SELECT t.id, t.sender_id, t.receiver_id, t.sender_listing_id, t.receiver_listing_id,
-                       t.status, t.message, t.created_at, t.updated_at
-                FROM trades t
-                WHERE t.sender_id = $1 AND t.status = $2
-                ORDER BY t.created_at DESC
-            `
-			args = []interface{}{userUUID, status}
-		}
-	} else { // all
-		if status == "all" {
-			query = `
-                SELECT t.id, t.sender_id, t.receiver_id, t.sender_listing_id, t.receiver_listing_id,
-                       t.status, t.message, t.created_at, t.updated_at
-                FROM trades t
-                WHERE t.sender_id = $1 OR t.receiver_id = $1
-                ORDER BY t.created_at DESC
-            `
-			args = []interface{}{userUUID}
-		} else {
-			query = `
-                SELECT t.id, t.sender_id, t.receiver_id, t.sender_listing_id, t.receiver_listing_id,
-                       t.status, t.message, t.created_at, t.updated_at
-                FROM trades t
-                WHERE (t.sender_id = $1 OR t.receiver_id = $1) AND t.status = $2
-                ORDER BY t.created_at DESC
-            `
-			args = []interface{}{userUUID, status}
-		}
+	// Формируем запрос в зависимости от типа и статуса
+	var conditions []string
+	args := []interface{}{userUUID}
+
+	switch tradeType {
+	case "incoming":
+		conditions = append(conditions, "t.receiver_id = $1")
+	case "outgoing":
+		conditions = append(conditions, "t.sender_id = $1")
+	default: // all
+		conditions = append(conditions, "(t.sender_id = $1 OR t.receiver_id = $1)")
+	}
+
+	if status != "all" {
+		args = append(args, status)
+		conditions = append(conditions, fmt.Sprintf("t.status = $%d", len(args)))
+	}
+
+	if cursor != nil {
+		args = append(args, cursor.Time, cursor.ID)
+		conditions = append(conditions, fmt.Sprintf("(t.created_at, t.id) < ($%d, $%d)", len(args)-1, len(args)))
 	}
 
+	// Запрашиваем на одну запись больше, чтобы понять, есть ли следующая страница
+	query := fmt.Sprintf(`
+        SELECT t.id, t.sender_id, t.receiver_id, t.sender_listing_id, t.receiver_listing_id,
+               t.status, t.message, t.parent_trade_id, t.created_at, t.updated_at,
+               t.accepted_at, t.sender_confirmed_at, t.receiver_confirmed_at, t.completed_at, t.confirmation_overdue_at,
+               (SELECT ct.id FROM trades ct WHERE ct.parent_trade_id = t.id LIMIT 1) AS counter_trade_id,
+               (SELECT ch.id FROM chats ch WHERE ch.trade_id = t.id LIMIT 1) AS chat_id
+        FROM trades t
+        WHERE %s
+        ORDER BY t.created_at DESC, t.id DESC
+        LIMIT $%d OFFSET $%d
+    `, strings.Join(conditions, " AND "), len(args)+1, len(args)+2)
+
+	// LIMIT NULL в PostgreSQL означает отсутствие ограничения
+	var pageLimit interface{}
+	if paginate {
+		pageLimit = limit + 1
+	}
+	args = append(args, pageLimit, offset)
+
 	// Выполняем запрос
 	rows, err := db.Pool.Query(ctx, query, args...)
 	if err != nil {
@@ -260,8 +251,15 @@ func (s *TradeService) GetMyTrades(c fiber.Ctx) error {
 
 	// Обрабатываем результаты
 	var trades []models.Trade
+	fetched := 0
 	for rows.Next() {
+		fetched++
+		if paginate && fetched > limit {
+			break
+		}
+
 		var trade models.Trade
+		var chatID *uuid.UUID
 		if err := rows.Scan(
 			&trade.ID,
 			&trade.SenderID,
@@ -270,35 +268,60 @@ func (s *TradeService) GetMyTrades(c fiber.Ctx) error {
 			&trade.ReceiverListingID,
 			&trade.Status,
 			&trade.Message,
+			&trade.ParentTradeID,
 			&trade.CreatedAt,
 			&trade.UpdatedAt,
+			&trade.AcceptedAt,
+			&trade.SenderConfirmedAt,
+			&trade.ReceiverConfirmedAt,
+			&trade.CompletedAt,
+			&trade.ConfirmationOverdueAt,
+			&trade.CounterTradeID,
+			&chatID,
 		); err != nil {
 			log.Printf("Ошибка сканирования строки: %v", err)
 			continue
 		}
 
-		// Загружаем дополнительную информацию об объявлениях и пользователях
-		trade.SenderListing = s.getListingInfo(ctx, trade.SenderListingID)
-		trade.ReceiverListing = s.getListingInfo(ctx, trade.ReceiverListingID)
-		trade.Sender = s.getUserInfo(ctx, trade.SenderID)
-		trade.Receiver = s.getUserInfo(ctx, trade.ReceiverID)
-
-		// Получаем ID чата, связанного с этим обменом (если есть)
-		var chatID *uuid.UUID
-		err = db.Pool.QueryRow(ctx, `
-            SELECT id FROM chats WHERE trade_id = $1 LIMIT 1
-        `, trade.ID).Scan(&chatID)
-
-		if err == nil && chatID != nil {
+		if chatID != nil {
 			trade.ChatID = *chatID // Добавляем ID чата к данным обмена
 		}
 
+		// Для ожидающих предложений показываем, когда они истекут
+		if trade.Status == "pending" {
+			expiresAt := trade.CreatedAt.Add(s.cfg.TradeTTL)
+			trade.ExpiresAt = &expiresAt
+		}
+
 		trades = append(trades, trade)
 	}
+	rows.Close()
+
+	// Загружаем объявления и участников всех обменов страницы
+	if err := db.AttachTradeDetails(ctx, trades); err != nil {
+		log.Printf("Ошибка загрузки деталей обменов: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка получения предложений обмена"})
+	}
+
+	// Курсор следующей страницы строится по последнему обмену
+	var nextCursor *string
+	if paginate && fetched > limit && len(trades) > 0 {
+		last := trades[len(trades)-1]
+		encoded := utils.EncodeCursor(utils.Cursor{Time: last.CreatedAt, ID: last.ID})
+		nextCursor = &encoded
+	}
+
+	var responseLimit interface{}
+	if paginate {
+		responseLimit = limit
+	}
 
 	return c.JSON(fiber.Map{
-		"trades": trades,
-		"count":  len(trades),
+		"trades":      trades,
+		"count":       len(trades),
+		"limit":       responseLimit,
+		"offset":      offset,
+		"next_cursor": nextCursor,
 	})
 }
 
@@ -348,10 +371,10 @@ func (s *TradeService) UpdateTradeStatus(c fiber.Ctx) error {
 	// Проверяем, существует ли предложение обмена и принадлежит ли оно пользователю
 	var trade models.Trade
 	err = db.Pool.QueryRow(ctx, `
-        SELECT id, sender_id, receiver_id, status
+        SELECT id, sender_id, receiver_id, sender_listing_id, receiver_listing_id, status
         FROM trades
         WHERE id = $1
-    `, tradeUUID).Scan(&trade.ID, &trade.SenderID, &trade.ReceiverID, &trade.Status)
+    `, tradeUUID).Scan(&trade.ID, &trade.SenderID, &trade.ReceiverID, &trade.SenderListingID, &trade.ReceiverListingID, &trade.Status)
 
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -365,6 +388,14 @@ func (s *TradeService) UpdateTradeStatus(c fiber.Ctx) error {
 	isReceiver := trade.ReceiverID == userUUID
 	isSender := trade.SenderID == userUUID
 
+	// Принятый обмен может отменить любой участник, например если второй не пришел на встречу
+	if trade.Status == "accepted" && requestData.Status == "canceled" {
+		if !isSender && !isReceiver {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Вы не участвуете в этом обмене"})
+		}
+		return s.cancelAcceptedTrade(c, trade, userUUID)
+	}
+
 	if requestData.Status == "accepted" || requestData.Status == "rejected" {
 		// Только получатель может принять или отклонить предложение
 		if !isReceiver {
@@ -378,52 +409,122 @@ func (s *TradeService) UpdateTradeStatus(c fiber.Ctx) error {
 	}
 
 	// Проверяем текущий статус
+	if trade.Status == tradeStatusCountered {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "На это предложение уже сделано встречное, ответить можно только на последнее предложение",
+		})
+	}
+
 	if trade.Status != "pending" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Нельзя изменить статус предложения, которое уже не находится в ожидании",
 		})
 	}
 
-	// Обновляем статус предложения обмена
-	_, err = db.Pool.Exec(ctx, `
+	// Начинаем транзакцию
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		log.Printf("Ошибка начала транзакции: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка базы данных"})
+	}
+	defer tx.Rollback(ctx)
+
+	// При принятии обмена резервируются все объявления обеих сторон.
+	// Объявления блокируются до обновления обмена, чтобы параллельные
+	// принятия обменов с теми же объявлениями выполнялись по очереди
+	var listingIDs []uuid.UUID
+	if requestData.Status == "accepted" {
+		senderListingIDs, receiverListingIDs, err := db.GetTradeListingIDs(ctx, tx, tradeUUID)
+		if err != nil {
+			log.Printf("Ошибка получения объявлений обмена: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка обновления статуса предложения"})
+		}
+		listingIDs = append(senderListingIDs, receiverListingIDs...)
+
+		err = db.SetListingsStatus(ctx, tx, listingIDs, models.ListingStatusReserved)
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidListingTransition) || err == pgx.ErrNoRows {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Одно из объявлений больше не доступно для обмена"})
+			}
+			log.Printf("Ошибка резервирования объявлений: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка обновления статуса предложения"})
+		}
+	}
+
+	// Время принятия нужно для проверки срока подтверждения обмена
+	var acceptedAt *time.Time
+	if requestData.Status == "accepted" {
+		now := time.Now()
+		acceptedAt = &now
+	}
+
+	// Обновляем статус предложения обмена, если его еще никто не изменил
+	tag, err := tx.Exec(ctx, `
         UPDATE trades
-        SET status = $1, updated_at = NOW()
-        WHERE id = $2
-    `, requestData.Status, tradeUUID)
+        SET status = $1, accepted_at = $3, updated_at = NOW()
+        WHERE id = $2 AND status = 'pending'
+    `, requestData.Status, tradeUUID, acceptedAt)
 
 	if err != nil {
 		log.Printf("Ошибка обновления статуса предложения: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка обновления статуса предложения"})
 	}
 
-	// Если обмен принят, создаем чат между участниками
-	var chatID uuid.UUID
-	if requestData.Status == "accepted" {
-		// Создаем чат
-		chatID = uuid.New()
-		now := time.Now()
-		initialMessage := "Обмен был принят. Вы можете обсудить детали здесь."
+	if tag.RowsAffected() == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Нельзя изменить статус предложения, которое уже не находится в ожидании",
+		})
+	}
 
-		// Создаем запись в таблице чатов
-		_, err = db.Pool.Exec(ctx, `
-            INSERT INTO chats (id, trade_id, sender_id, receiver_id, created_at, updated_at, last_message_text, last_message_time, is_active)
-            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-        `, chatID, tradeUUID, trade.SenderID, trade.ReceiverID, now, now, initialMessage, now, true)
+	// Остальные ожидающие предложения с этими объявлениями закрываются
+	var superseded []supersededTrade
+	if requestData.Status == "accepted" {
+		superseded, err = supersedeConflictingTrades(ctx, tx, tradeUUID, listingIDs, supersededByTradeReason, &userUUID)
+		if err != nil {
+			log.Printf("Ошибка закрытия конкурирующих предложений: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка обновления статуса предложения"})
+		}
+	}
 
+	// Чат и первое сообщение создаются в той же транзакции,
+	// чтобы принятый обмен не остался без чата
+	var chatID uuid.UUID
+	if requestData.Status == "accepted" {
+		chatID, err = db.CreateTradeChat(ctx, tx, tradeUUID, trade.SenderID, trade.ReceiverID)
 		if err != nil {
 			log.Printf("Ошибка создания чата для обмена: %v", err)
-			// Не возвращаем ошибку, т.к. основная функциональность выполнена
-		} else {
-			// Добавляем системное сообщение
-			messageID := uuid.New()
-			_, err = db.Pool.Exec(ctx, `
-                INSERT INTO messages (id, chat_id, sender_id, text, is_read, created_at, updated_at)
-                VALUES ($1, $2, $3, $4, $5, $6, $7)
-            `, messageID, chatID, trade.SenderID, initialMessage, false, now, now)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка создания чата для обмена"})
+		}
+	}
 
-			if err != nil {
-				log.Printf("Ошибка создания системного сообщения: %v", err)
-				// Не возвращаем ошибку, т.к. основная функциональность выполнена
+	// Статусы запроса совпадают с типами событий accepted, rejected и canceled
+	var eventData map[string]interface{}
+	if requestData.Status == "accepted" {
+		eventData = map[string]interface{}{"chat_id": chatID}
+	}
+	if err = db.RecordTradeEvent(ctx, tx, tradeUUID, requestData.Status, &userUUID, eventData); err != nil {
+		log.Printf("Ошибка записи истории обмена: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка обновления статуса предложения"})
+	}
+
+	// Фиксируем транзакцию
+	if err = tx.Commit(ctx); err != nil {
+		log.Printf("Ошибка фиксации транзакции: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ошибка базы данных"})
+	}
+
+	// Оповещаем второго участника обмена
+	otherUserID := trade.SenderID
+	if userUUID == trade.SenderID {
+		otherUserID = trade.ReceiverID
+	}
+	s.notifyTradeUpdate(otherUserID, tradeUUID, requestData.Status, "")
+
+	// Оповещаем участников вытесненных предложений
+	for _, t := range superseded {
+		for _, participantID := range []uuid.UUID{t.SenderID, t.ReceiverID} {
+			if participantID != userUUID {
+				s.notifyTradeUpdate(participantID, t.ID, tradeStatusSuperseded, supersededByTradeReason)
 			}
 		}
 	}
@@ -449,90 +550,96 @@ func (s *TradeService) UpdateTradeStatus(c fiber.Ctx) error {
 	// Если был создан чат, включаем его ID в ответ
 	if requestData.Status == "accepted" {
 		response["chat_id"] = chatID
+		response["superseded_count"] = len(superseded)
 	}
 
 	return c.JSON(response)
 }
 
-// getListingInfo получает информацию об объявлении
-func (s *TradeService) getListingInfo(ctx context.Context, listingID uuid.UUID) *models.Listing {
-	var listing models.Listing
-	var categoriesData []byte
-
-	err := db.Pool.QueryRow(ctx, `
-        SELECT id, user_id, title, description, categories, condition, allow_trade, status
-        FROM listings
-        WHERE id = $1
-    `, listingID).Scan(
-		&listing.ID,
-		&listing.UserID,
-		&listing.Title,
-		&listing.Description,
-		&categoriesData,
-		&listing.Condition,
-		&listing.AllowTrade,
-		&listing.Status,
-	)
+// supersedeConflictingTrades закрывает ожидающие предложения, в которых участвуют
+// объявления принятого обмена, и возвращает их для оповещения участников.
+// Уведомление с причиной сохраняется тем же запросом для всех участников, кроме notifiedExcept,
+// чтобы о закрытии узнали и те, кто сейчас не в сети
+func supersedeConflictingTrades(ctx context.Context, tx pgx.Tx, acceptedID uuid.UUID, listingIDs []uuid.UUID, reason string, notifiedExcept *uuid.UUID) ([]supersededTrade, error) {
+	rows, err := tx.Query(ctx, `
+        WITH superseded AS (
+            UPDATE trades
+            SET status = $1, updated_at = NOW()
+            WHERE id != $2 AND status = 'pending'
+              AND id IN (SELECT trade_id FROM trade_items WHERE listing_id = ANY($3))
+            RETURNING id, sender_id, receiver_id
+        ), notified AS (
+            INSERT INTO notifications (user_id, type, payload)
+            SELECT participant.user_id, $4, jsonb_build_object('trade_id', s.id, 'status', $1::text, 'reason', $5::text)
+            FROM superseded s
+            CROSS JOIN LATERAL (VALUES (s.sender_id), (s.receiver_id)) AS participant(user_id)
+            WHERE participant.user_id IS DISTINCT FROM $6::uuid
+        )
+        SELECT id, sender_id, receiver_id FROM superseded
+    `, tradeStatusSuperseded, acceptedID, listingIDs, models.NotificationTradeUpdated, reason, notifiedExcept)
 
 	if err != nil {
-		log.Printf("Ошибка получения объявления %s: %v", listingID, err)
-		return nil
+		return nil, err
 	}
+	defer rows.Close()
 
-	// Преобразуем JSONB категории в массив строк
-	if err := json.Unmarshal(categoriesData, &listing.Categories); err != nil {
-		log.Printf("Ошибка разбора категорий: %v", err)
-		listing.Categories = []string{}
+	var superseded []supersededTrade
+	var tradeIDs []uuid.UUID
+	for rows.Next() {
+		var t supersededTrade
+		if err := rows.Scan(&t.ID, &t.SenderID, &t.ReceiverID); err != nil {
+			return nil, err
+		}
+		superseded = append(superseded, t)
+		tradeIDs = append(tradeIDs, t.ID)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
 
-	// Получаем изображения объявления
-	rows, err := db.Pool.Query(ctx, `
-        SELECT id, url, preview_url, is_main
-        FROM listing_images
-        WHERE listing_id = $1
-        ORDER BY position ASC
-    `, listingID)
-
-	if err != nil {
-		log.Printf("Ошибка получения изображений: %v", err)
-	} else {
-		defer rows.Close()
-
-		var images []models.ListingImage
-		for rows.Next() {
-			var image models.ListingImage
-			if err := rows.Scan(&image.ID, &image.URL, &image.PreviewURL, &image.IsMain); err != nil {
-				log.Printf("Ошибка сканирования изображения: %v", err)
-				continue
-			}
-			image.ListingID = listingID
-			images = append(images, image)
-		}
-		listing.Images = images
+	// Вытесненные предложения закрываются системой, а не участниками
+	eventData := map[string]interface{}{"reason": tradeStatusSuperseded}
+	if acceptedID != uuid.Nil {
+		eventData["accepted_trade_id"] = acceptedID
+	}
+	if err := db.RecordTradeEvents(ctx, tx, tradeIDs, models.TradeEventCanceled, nil, eventData); err != nil {
+		return nil, err
 	}
 
-	return &listing
+	return superseded, nil
 }
 
-// getUserInfo получает информацию о пользователе
-func (s *TradeService) getUserInfo(ctx context.Context, userID uuid.UUID) *models.User {
-	var user models.User
-	err := db.Pool.QueryRow(ctx, `
-        SELECT id, username, first_name, last_name, avatar_url
-        FROM users
-        WHERE id = $1
-    `, userID).Scan(
-		&user.ID,
-		&user.Username,
-		&user.FirstName,
-		&user.LastName,
-		&user.AvatarURL,
-	)
+// notifyTradeUpdate сообщает пользователю об изменении статуса обмена
+func (s *TradeService) notifyTradeUpdate(userID, tradeID uuid.UUID, status, reason string) {
+	payload, _ := json.Marshal(map[string]string{
+		"trade_id": tradeID.String(),
+		"status":   status,
+		"reason":   reason,
+	})
 
-	if err != nil {
-		log.Printf("Ошибка получения пользователя %s: %v", userID, err)
-		return nil
-	}
+	s.wsManager.SendToUser(userID.String(), websocket.Event{
+		Type:      websocket.EventTradeUpdated,
+		Timestamp: time.Now(),
+		Payload:   payload,
+	})
+}
 
-	return &user
+// StartChatRepairWorker периодически создает чаты для принятых обменов, оставшихся без чата
+func (s *TradeService) StartChatRepairWorker(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for ; ; <-ticker.C {
+			repaired, err := db.RepairTradeChats()
+			if err != nil {
+				log.Printf("Ошибка восстановления чатов обменов: %v", err)
+				continue
+			}
+			if repaired > 0 {
+				log.Printf("Восстановлено чатов для обменов: %d", repaired)
+			}
+		}
+	}()
 }
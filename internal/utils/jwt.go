@@ -1,56 +1,113 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/rajivgeraev/flippy-api/internal/config"
 )
 
+// Claims описывает данные access-токена
+type Claims struct {
+	UserID    string `json:"user_id"`
+	SessionID string `json:"sid"`  // Сессия в user_sessions, к которой привязан токен
+	Role      string `json:"role"` // Роль пользователя на момент выдачи токена
+	jwt.RegisteredClaims
+}
+
 // JWTService отвечает за создание и валидацию JWT токенов
 type JWTService struct {
-	secretKey string
+	keys     *KeySet
+	issuer   string
+	audience string
 }
 
-// NewJWTService создаёт новый экземпляр JWTService
-func NewJWTService(secretKey string) *JWTService {
-	return &JWTService{secretKey: secretKey}
+// NewJWTService создаёт новый экземпляр JWTService. Ключи загружаются при старте,
+// поэтому ошибка в них останавливает приложение
+func NewJWTService(cfg config.JWTConfig) *JWTService {
+	keys, err := NewKeySet(cfg)
+	if err != nil {
+		log.Fatalf("❌ Ошибка загрузки ключей JWT: %v", err)
+	}
+
+	return &JWTService{
+		keys:     keys,
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+	}
 }
 
-// GenerateToken создаёт JWT токен
-func (s *JWTService) GenerateToken(userID string) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(24 * time.Hour).Unix(),
-		"iat":     time.Now().Unix(),
+// GenerateToken создаёт короткоживущий access-токен для сессии пользователя
+func (s *JWTService) GenerateToken(userID, sessionID, role string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		UserID:    userID,
+		SessionID: sessionID,
+		Role:      role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.issuer,
+			Subject:   userID,
+			Audience:  jwt.ClaimStrings{s.audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.secretKey))
+	token := jwt.NewWithClaims(s.keys.signingMethod, claims)
+	token.Header["kid"] = s.keys.signingKeyID
+	return token.SignedString(s.keys.signingKey)
 }
 
-// ValidateToken проверяет JWT токен
-func (s *JWTService) ValidateToken(tokenString string) (*jwt.Token, error) {
-	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte(s.secretKey), nil
-	})
+// ParseToken проверяет подпись, алгоритм, срок действия, издателя и получателя токена
+func (s *JWTService) ParseToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, s.keys.keyFunc,
+		jwt.WithValidMethods(s.keys.Algorithms()),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithIssuer(s.issuer),
+		jwt.WithAudience(s.audience),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid || claims.UserID == "" || claims.SessionID == "" {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+
+	return claims, nil
 }
 
 // ExtractUserID извлекает ID пользователя из токена
 func (s *JWTService) ExtractUserID(tokenString string) (string, error) {
-	token, err := s.ValidateToken(tokenString)
+	claims, err := s.ParseToken(tokenString)
 	if err != nil {
 		return "", err
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok || !token.Valid {
-		return "", jwt.ErrTokenInvalidClaims
-	}
+	return claims.UserID, nil
+}
 
-	userID, ok := claims["user_id"].(string)
-	if !ok {
-		return "", jwt.ErrTokenInvalidClaims
+// GenerateRefreshToken создаёт случайный refresh-токен и его хеш для хранения в базе
+func GenerateRefreshToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
 	}
 
-	return userID, nil
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken возвращает хеш refresh-токена. Сами токены в базе не хранятся
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
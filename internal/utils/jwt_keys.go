@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"crypto"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/rajivgeraev/flippy-api/internal/config"
+)
+
+// minRSAKeyBits - минимальный размер ключа RSA
+const minRSAKeyBits = 2048
+
+// jwtKey - ключ проверки подписи вместе с единственным допустимым для него алгоритмом
+type jwtKey struct {
+	method    jwt.SigningMethod
+	verifyKey interface{}
+}
+
+// KeySet хранит ключ подписи новых токенов и все ключи, по которым токены проверяются.
+// Ключ выбирается по заголовку kid, поэтому секрет можно сменить, не разлогинивая пользователей
+type KeySet struct {
+	signingKeyID  string
+	signingMethod jwt.SigningMethod
+	signingKey    interface{}
+	keys          map[string]jwtKey
+}
+
+// NewKeySet загружает ключи JWT из конфигурации
+func NewKeySet(cfg config.JWTConfig) (*KeySet, error) {
+	if cfg.KeyID == "" {
+		return nil, fmt.Errorf("не задан kid ключа подписи")
+	}
+
+	method, err := signingMethod(cfg.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	ks := &KeySet{
+		signingKeyID:  cfg.KeyID,
+		signingMethod: method,
+		keys:          make(map[string]jwtKey),
+	}
+
+	if method == jwt.SigningMethodHS256 {
+		ks.signingKey = []byte(cfg.Secret)
+		ks.keys[cfg.KeyID] = jwtKey{method: method, verifyKey: ks.signingKey}
+	} else {
+		signer, err := loadPrivateKey(method, cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		ks.signingKey = signer
+		ks.keys[cfg.KeyID] = jwtKey{method: method, verifyKey: signer.Public()}
+	}
+
+	for _, vk := range cfg.VerificationKeys {
+		if _, exists := ks.keys[vk.KeyID]; exists {
+			return nil, fmt.Errorf("ключ с kid %q задан несколько раз", vk.KeyID)
+		}
+
+		method, err := signingMethod(vk.Algorithm)
+		if err != nil {
+			return nil, fmt.Errorf("ключ %q: %w", vk.KeyID, err)
+		}
+
+		key := jwtKey{method: method}
+		if method == jwt.SigningMethodHS256 {
+			key.verifyKey = []byte(vk.Secret)
+		} else if key.verifyKey, err = loadPublicKey(method, vk.KeyFile); err != nil {
+			return nil, fmt.Errorf("ключ %q: %w", vk.KeyID, err)
+		}
+		ks.keys[vk.KeyID] = key
+	}
+
+	return ks, nil
+}
+
+// Algorithms возвращает алгоритмы всех ключей набора
+func (ks *KeySet) Algorithms() []string {
+	seen := make(map[string]bool)
+	var algs []string
+	for _, key := range ks.keys {
+		if alg := key.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
+
+// keyFunc выбирает ключ проверки по kid и отклоняет токен, если его алгоритм не совпадает с алгоритмом ключа.
+// Это исключает подмену алгоритма, например проверку RS256-ключа как HMAC-секрета
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok || kid == "" {
+		return nil, fmt.Errorf("в токене нет kid")
+	}
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("неизвестный kid %q", kid)
+	}
+
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("алгоритм %s не подходит для ключа %q", token.Method.Alg(), kid)
+	}
+
+	return key.verifyKey, nil
+}
+
+// signingMethod возвращает поддерживаемый алгоритм подписи по имени
+func signingMethod(alg string) (jwt.SigningMethod, error) {
+	switch alg {
+	case jwt.SigningMethodHS256.Alg():
+		return jwt.SigningMethodHS256, nil
+	case jwt.SigningMethodRS256.Alg():
+		return jwt.SigningMethodRS256, nil
+	case jwt.SigningMethodEdDSA.Alg():
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("неподдерживаемый алгоритм JWT %q", alg)
+	}
+}
+
+// loadPrivateKey читает закрытый ключ RS256 или EdDSA из PEM-файла
+func loadPrivateKey(method jwt.SigningMethod, path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения закрытого ключа: %w", err)
+	}
+
+	if method == jwt.SigningMethodRS256 {
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка разбора ключа RSA: %w", err)
+		}
+		if key.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("ключ RSA должен быть не короче %d бит", minRSAKeyBits)
+		}
+		return key, nil
+	}
+
+	key, err := jwt.ParseEdPrivateKeyFromPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка разбора ключа Ed25519: %w", err)
+	}
+	return key.(crypto.Signer), nil
+}
+
+// loadPublicKey читает открытый ключ RS256 или EdDSA из PEM-файла
+func loadPublicKey(method jwt.SigningMethod, path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения открытого ключа: %w", err)
+	}
+
+	if method == jwt.SigningMethodRS256 {
+		key, err := jwt.ParseRSAPublicKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка разбора ключа RSA: %w", err)
+		}
+		if key.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("ключ RSA должен быть не короче %d бит", minRSAKeyBits)
+		}
+		return key, nil
+	}
+
+	key, err := jwt.ParseEdPublicKeyFromPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка разбора ключа Ed25519: %w", err)
+	}
+	return key, nil
+}
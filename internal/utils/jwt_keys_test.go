@@ -0,0 +1,260 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/rajivgeraev/flippy-api/internal/config"
+)
+
+const (
+	testIssuer   = "flippy-test"
+	testAudience = "flippy-test-api"
+	testSecret   = "previous-hs256-secret-for-tests"
+)
+
+// writeRSAKeys создает ключ RSA заданного размера и сохраняет закрытый и открытый ключи в PEM-файлы
+func writeRSAKeys(t *testing.T, bits int) (*rsa.PrivateKey, string, string) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatalf("генерация ключа RSA: %v", err)
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("кодирование открытого ключа: %v", err)
+	}
+
+	dir := t.TempDir()
+	privateFile := filepath.Join(dir, "private.pem")
+	publicFile := filepath.Join(dir, "public.pem")
+	writePEM(t, privateFile, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+	writePEM(t, publicFile, "PUBLIC KEY", publicDER)
+
+	return key, privateFile, publicFile
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("запись %s: %v", path, err)
+	}
+}
+
+// signTestToken подписывает токен с заданными алгоритмом, kid и ключом.
+// Пустой kid не попадает в заголовок
+func signTestToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims Claims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("подпись токена: %v", err)
+	}
+	return signed
+}
+
+func testClaims(issuer, audience string) Claims {
+	now := time.Now()
+	return Claims{
+		UserID:    "11111111-1111-1111-1111-111111111111",
+		SessionID: "22222222-2222-2222-2222-222222222222",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Audience:  jwt.ClaimStrings{audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+}
+
+func TestParseTokenKeySelection(t *testing.T) {
+	rsaKey, privateFile, publicFile := writeRSAKeys(t, minRSAKeyBits)
+
+	// Новые токены подписываются RS256, токены старого HS256-секрета еще принимаются
+	keys, err := NewKeySet(config.JWTConfig{
+		Algorithm:      "RS256",
+		KeyID:          "rsa-1",
+		PrivateKeyFile: privateFile,
+		VerificationKeys: []config.JWTVerificationKey{
+			{KeyID: "hs-1", Algorithm: "HS256", Secret: testSecret},
+		},
+	})
+	if err != nil {
+		t.Fatalf("загрузка ключей: %v", err)
+	}
+	service := &JWTService{keys: keys, issuer: testIssuer, audience: testAudience}
+
+	publicPEM, err := os.ReadFile(publicFile)
+	if err != nil {
+		t.Fatalf("чтение открытого ключа: %v", err)
+	}
+
+	valid := testClaims(testIssuer, testAudience)
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{
+			name:  "RS256 с ключом подписи",
+			token: signTestToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, valid),
+			valid: true,
+		},
+		{
+			name:  "HS256 с ключом проверки",
+			token: signTestToken(t, jwt.SigningMethodHS256, "hs-1", []byte(testSecret), valid),
+			valid: true,
+		},
+		{
+			// Классическая подмена: открытый ключ RSA используется как HMAC-секрет
+			name:  "HS256 с kid ключа RS256",
+			token: signTestToken(t, jwt.SigningMethodHS256, "rsa-1", publicPEM, valid),
+		},
+		{
+			name:  "RS256 с kid ключа HS256",
+			token: signTestToken(t, jwt.SigningMethodRS256, "hs-1", rsaKey, valid),
+		},
+		{
+			name:  "HS256 с неверным секретом",
+			token: signTestToken(t, jwt.SigningMethodHS256, "hs-1", []byte("other-secret"), valid),
+		},
+		{
+			name:  "неизвестный kid",
+			token: signTestToken(t, jwt.SigningMethodRS256, "rsa-2", rsaKey, valid),
+		},
+		{
+			name:  "без kid",
+			token: signTestToken(t, jwt.SigningMethodRS256, "", rsaKey, valid),
+		},
+		{
+			name:  "алгоритм none",
+			token: signTestToken(t, jwt.SigningMethodNone, "hs-1", jwt.UnsafeAllowNoneSignatureType, valid),
+		},
+		{
+			name:  "чужой издатель",
+			token: signTestToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, testClaims("other", testAudience)),
+		},
+		{
+			name:  "чужой получатель",
+			token: signTestToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, testClaims(testIssuer, "other")),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := service.ParseToken(tt.token)
+			if tt.valid {
+				if err != nil {
+					t.Fatalf("токен отклонен: %v", err)
+				}
+				if claims.UserID != valid.UserID {
+					t.Fatalf("user_id %q, ожидался %q", claims.UserID, valid.UserID)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("токен принят")
+			}
+		})
+	}
+}
+
+func TestGenerateTokenRoundTrip(t *testing.T) {
+	_, privateFile, _ := writeRSAKeys(t, minRSAKeyBits)
+
+	keys, err := NewKeySet(config.JWTConfig{Algorithm: "RS256", KeyID: "rsa-1", PrivateKeyFile: privateFile})
+	if err != nil {
+		t.Fatalf("загрузка ключей: %v", err)
+	}
+	service := &JWTService{keys: keys, issuer: testIssuer, audience: testAudience}
+
+	token, err := service.GenerateToken("user", "session", "user", time.Minute)
+	if err != nil {
+		t.Fatalf("выпуск токена: %v", err)
+	}
+
+	claims, err := service.ParseToken(token)
+	if err != nil {
+		t.Fatalf("выпущенный токен отклонен: %v", err)
+	}
+	if claims.UserID != "user" || claims.SessionID != "session" {
+		t.Fatalf("неверные данные токена: %+v", claims)
+	}
+}
+
+func TestNewKeySetRejectsInvalidKeys(t *testing.T) {
+	_, smallPrivateFile, smallPublicFile := writeRSAKeys(t, 1024)
+
+	tests := []struct {
+		name    string
+		cfg     config.JWTConfig
+		message string
+	}{
+		{
+			name:    "короткий закрытый ключ RSA",
+			cfg:     config.JWTConfig{Algorithm: "RS256", KeyID: "rsa-1", PrivateKeyFile: smallPrivateFile},
+			message: "не короче",
+		},
+		{
+			name: "короткий открытый ключ RSA",
+			cfg: config.JWTConfig{
+				Algorithm: "HS256", KeyID: "hs-1", Secret: testSecret,
+				VerificationKeys: []config.JWTVerificationKey{
+					{KeyID: "rsa-old", Algorithm: "RS256", KeyFile: smallPublicFile},
+				},
+			},
+			message: "не короче",
+		},
+		{
+			name:    "без kid",
+			cfg:     config.JWTConfig{Algorithm: "HS256", Secret: testSecret},
+			message: "kid",
+		},
+		{
+			name:    "неподдерживаемый алгоритм",
+			cfg:     config.JWTConfig{Algorithm: "HS512", KeyID: "hs-1", Secret: testSecret},
+			message: "неподдерживаемый алгоритм",
+		},
+		{
+			name: "повторный kid",
+			cfg: config.JWTConfig{
+				Algorithm: "HS256", KeyID: "hs-1", Secret: testSecret,
+				VerificationKeys: []config.JWTVerificationKey{
+					{KeyID: "hs-1", Algorithm: "HS256", Secret: "other-secret"},
+				},
+			},
+			message: "несколько раз",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKeySet(tt.cfg)
+			if err == nil {
+				t.Fatalf("ключи приняты")
+			}
+			if !strings.Contains(err.Error(), tt.message) {
+				t.Fatalf("ошибка %q не содержит %q", err, tt.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultPageLimit количество элементов на странице по умолчанию
+	DefaultPageLimit = 20
+
+	// MaxPageLimit максимальное количество элементов, которое может запросить клиент
+	MaxPageLimit = 100
+)
+
+// ErrInvalidCursor возвращается при разборе поврежденного или чужого курсора
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor указывает на последний элемент страницы при keyset-пагинации.
+// Клиенты получают его в виде непрозрачной строки
+type Cursor struct {
+	Time     time.Time `json:"t"`
+	ID       uuid.UUID `json:"id"`
+	Rank     *float32  `json:"r,omitempty"` // Релевантность, если выдача отсортирована по ней
+	Distance *float64  `json:"d,omitempty"` // Расстояние, если выдача отсортирована по нему
+}
+
+// EncodeCursor кодирует курсор в строку для передачи клиенту
+func EncodeCursor(cursor Cursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor разбирает строку курсора, полученную от клиента
+func DecodeCursor(value string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == uuid.Nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+// ParseLimit возвращает размер страницы из параметра запроса с учетом ограничений
+func ParseLimit(value string) int {
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		return DefaultPageLimit
+	}
+	if limit > MaxPageLimit {
+		return MaxPageLimit
+	}
+	return limit
+}
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	rank := float32(0.75)
+	distance := 12.5
+	createdAt := time.Date(2024, 5, 17, 10, 30, 0, 123456789, time.UTC)
+
+	cursors := map[string]Cursor{
+		"по времени":       {Time: createdAt, ID: uuid.New()},
+		"по релевантности": {Time: createdAt, ID: uuid.New(), Rank: &rank},
+		"по расстоянию":    {Time: createdAt, ID: uuid.New(), Distance: &distance},
+	}
+
+	for name, cursor := range cursors {
+		t.Run(name, func(t *testing.T) {
+			decoded, err := DecodeCursor(EncodeCursor(cursor))
+			if err != nil {
+				t.Fatalf("разбор курсора: %v", err)
+			}
+			if !decoded.Time.Equal(cursor.Time) {
+				t.Fatalf("время %v, ожидалось %v", decoded.Time, cursor.Time)
+			}
+			decoded.Time = cursor.Time
+			if !reflect.DeepEqual(*decoded, cursor) {
+				t.Fatalf("курсор %+v, ожидался %+v", *decoded, cursor)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorRejectsInvalid(t *testing.T) {
+	values := map[string]string{
+		"пустая строка": "",
+		"не base64":     "не курсор!",
+		"не JSON":       base64.RawURLEncoding.EncodeToString([]byte("cursor")),
+		"без ID":        base64.RawURLEncoding.EncodeToString([]byte(`{"t":"2024-05-17T10:30:00Z"}`)),
+		"ID не UUID":    base64.RawURLEncoding.EncodeToString([]byte(`{"id":"42"}`)),
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			if _, err := DecodeCursor(value); !errors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("ожидалась ErrInvalidCursor, получено %v", err)
+			}
+		})
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := map[string]int{
+		"":    DefaultPageLimit,
+		"abc": DefaultPageLimit,
+		"0":   DefaultPageLimit,
+		"-5":  DefaultPageLimit,
+		"1":   1,
+		"50":  50,
+		"101": MaxPageLimit,
+	}
+
+	for value, want := range tests {
+		if got := ParseLimit(value); got != want {
+			t.Errorf("ParseLimit(%q) = %d, ожидалось %d", value, got, want)
+		}
+	}
+}
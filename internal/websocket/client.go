@@ -3,6 +3,7 @@ package websocket
 import (
 	"encoding/json"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -27,24 +28,37 @@ const (
 type Client struct {
 	ID        uuid.UUID
 	UserID    string
+	SessionID string // Сессия, по токену которой открыто соединение
+	expiresAt time.Time
 	conn      *websocket.Conn
 	send      chan []byte // Буферизованный канал исходящих сообщений
 	manager   *Manager
 	closeChan chan struct{}
+	revoked   chan struct{} // Закрывается, когда сессию соединения отозвали
+	revokeMu  sync.Once
 }
 
-// NewClient создает новый экземпляр Client
-func NewClient(userID string, conn *websocket.Conn, manager *Manager) *Client {
+// NewClient создает новый экземпляр Client. Соединение закрывается в expiresAt,
+// когда истекает access-токен, по которому оно открыто
+func NewClient(userID, sessionID string, expiresAt time.Time, conn *websocket.Conn, manager *Manager) *Client {
 	return &Client{
 		ID:        uuid.New(),
 		UserID:    userID,
+		SessionID: sessionID,
+		expiresAt: expiresAt,
 		conn:      conn,
 		send:      make(chan []byte, writeBufferSize),
 		manager:   manager,
 		closeChan: make(chan struct{}),
+		revoked:   make(chan struct{}),
 	}
 }
 
+// Revoke закрывает соединение, сессия которого отозвана. Безопасно вызывать повторно
+func (c *Client) Revoke() {
+	c.revokeMu.Do(func() { close(c.revoked) })
+}
+
 // Start запускает клиентские горутины для чтения и записи
 func (c *Client) Start() {
 	// Добавляем клиент к менеджеру
@@ -89,8 +103,10 @@ func (c *Client) readPump() {
 // writePump отправляет сообщения клиенту
 func (c *Client) writePump() {
 	ticker := time.NewTicker(pingPeriod)
+	expiry := time.NewTimer(time.Until(c.expiresAt))
 	defer func() {
 		ticker.Stop()
+		expiry.Stop()
 		c.conn.Close()
 	}()
 
@@ -115,6 +131,13 @@ func (c *Client) writePump() {
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
+		case <-expiry.C:
+			// Токен истек: клиент должен переподключиться с новым токеном
+			c.writeClose("token expired")
+			return
+		case <-c.revoked:
+			c.writeClose("session revoked")
+			return
 		case <-c.closeChan:
 			// Соединение закрыто
 			return
@@ -122,6 +145,13 @@ func (c *Client) writePump() {
 	}
 }
 
+// writeClose сообщает клиенту, почему сервер закрывает соединение.
+// Закрытие conn после этого завершает и readPump, который удаляет клиента из менеджера
+func (c *Client) writeClose(reason string) {
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason))
+}
+
 // handleIncomingMessage обрабатывает входящие сообщения от клиента
 func (c *Client) handleIncomingMessage(message []byte) {
 	// Парсим сообщение
@@ -146,18 +176,35 @@ func (c *Client) handleIncomingMessage(message []byte) {
 
 	// Обрабатываем различные типы событий
 	switch event.Type {
-	case EventTyping:
-		if event.ChatID != "" {
-			// TODO: Отправить уведомление о печати всем участникам чата
+	case EventTyping, EventStopTyping:
+		if event.ChatID == "" {
+			return
 		}
-	case EventStopTyping:
-		if event.ChatID != "" {
-			// TODO: Отправить уведомление о прекращении печати
+
+		// Пересылаем событие только участникам чата
+		if !c.manager.IsChatParticipant(event.ChatID, c.UserID) {
+			log.Printf("User %s is not a participant of chat %s", c.UserID, event.ChatID)
+			return
+		}
+
+		if event.Type == EventTyping {
+			c.manager.StartTyping(event.ChatID, c.UserID)
+		} else {
+			c.manager.StopTyping(event.ChatID, c.UserID)
 		}
 	case EventMessageRead:
-		if event.ChatID != "" && event.MessageID != "" {
-			// TODO: Обновить статус сообщения как прочитанное
-			// и оповестить всех участников чата
+		if event.ChatID == "" || event.MessageID == "" {
+			return
+		}
+
+		if !c.manager.IsChatParticipant(event.ChatID, c.UserID) {
+			log.Printf("User %s is not a participant of chat %s", c.UserID, event.ChatID)
+			return
+		}
+
+		// Обновление статуса и оповещение участников выполняет сервис чатов
+		if c.manager.onRead != nil {
+			c.manager.onRead(event.ChatID, event.MessageID, c.UserID)
 		}
 	// Другие типы событий могут быть обработаны здесь
 	default:
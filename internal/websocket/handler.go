@@ -0,0 +1,122 @@
+package websocket
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/adaptor"
+	"github.com/gorilla/websocket"
+
+	"github.com/rajivgeraev/flippy-api/internal/config"
+	"github.com/rajivgeraev/flippy-api/internal/middleware"
+	"github.com/rajivgeraev/flippy-api/internal/utils"
+)
+
+// tokenSubprotocol - подпротокол, вместе с которым браузерный клиент передает токен:
+// Sec-WebSocket-Protocol: bearer, <token>. Сервер подтверждает только bearer, токен в ответ не попадает
+const tokenSubprotocol = "bearer"
+
+// Handler обрабатывает подключения к WebSocket
+type Handler struct {
+	cfg        *config.Config
+	jwtService *utils.JWTService
+	manager    *Manager
+	upgrader   websocket.Upgrader
+}
+
+// NewHandler создает новый экземпляр Handler
+func NewHandler(cfg *config.Config, manager *Manager) *Handler {
+	h := &Handler{
+		cfg:        cfg,
+		jwtService: utils.NewJWTService(cfg.JWT),
+		manager:    manager,
+	}
+
+	h.upgrader = websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		Subprotocols:    []string{tokenSubprotocol},
+		CheckOrigin:     h.checkOrigin,
+	}
+
+	return h
+}
+
+// checkOrigin разрешает подключения без заголовка Origin (не из браузера), со своего домена
+// и с источников из WS_ALLOWED_ORIGINS. CORS на WebSocket не распространяется,
+// поэтому без этой проверки любой сайт мог бы подключиться от имени пользователя
+func (h *Handler) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	for _, allowed := range h.cfg.WSAllowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// SetupRoutes настраивает маршрут для WebSocket подключения
+func (h *Handler) SetupRoutes(app *fiber.App) {
+	app.Get("/ws", h.HandleConnection)
+}
+
+// HandleConnection проверяет JWT и переводит соединение в WebSocket
+func (h *Handler) HandleConnection(c fiber.Ctx) error {
+	// Браузеры не позволяют задать заголовок Authorization для WebSocket,
+	// поэтому токен передается вторым значением Sec-WebSocket-Protocol.
+	// В адресе токен не принимается: он попал бы в логи и историю браузера
+	tokenString := tokenFromSubprotocols(c.Get("Sec-WebSocket-Protocol"))
+	if tokenString == "" {
+		parts := strings.Split(c.Get("Authorization"), " ")
+		if len(parts) == 2 && parts[0] == "Bearer" {
+			tokenString = parts[1]
+		}
+	}
+
+	if tokenString == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Missing authorization token",
+		})
+	}
+
+	// Отозванная сессия не может открыть новое соединение
+	claims, err := middleware.Authenticate(h.jwtService, tokenString)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired token",
+		})
+	}
+	// Соединение живет не дольше токена и закрывается при отзыве его сессии
+	userID, sessionID, expiresAt := claims.UserID, claims.SessionID, claims.ExpiresAt.Time
+
+	return adaptor.HTTPHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := h.upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Printf("Ошибка установки WebSocket соединения: %v", err)
+			return
+		}
+
+		client := NewClient(userID, sessionID, expiresAt, conn, h.manager)
+		client.Start()
+	})(c)
+}
+
+// tokenFromSubprotocols возвращает токен, переданный в заголовке Sec-WebSocket-Protocol после bearer
+func tokenFromSubprotocols(header string) string {
+	protocols := strings.Split(header, ",")
+	for i := 0; i+1 < len(protocols); i++ {
+		if strings.TrimSpace(protocols[i]) == tokenSubprotocol {
+			return strings.TrimSpace(protocols[i+1])
+		}
+	}
+	return ""
+}
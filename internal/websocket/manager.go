@@ -8,32 +8,58 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/rajivgeraev/flippy-api/internal/db"
 )
 
+// Время жизни закэшированного списка участников чата
+const chatParticipantsTTL = 5 * time.Minute
+
+// Как часто из кэша удаляются истекшие списки участников чатов
+const chatCacheSweepInterval = time.Minute
+
 // Manager представляет центральный менеджер для всех WebSocket соединений
 type Manager struct {
 	clients      map[uuid.UUID]*Client
 	clientsMutex sync.RWMutex
 	userClients  map[string]map[uuid.UUID]bool // userID -> map[clientID]bool
 	userMutex    sync.RWMutex
+	chats        map[string]chatParticipants // chatID -> участники чата
+	chatsMutex   sync.RWMutex
+	typing       map[typingKey]*time.Timer // активные индикаторы печати
+	typingMutex  sync.Mutex
+	onRead       MessageReadHandler
 	ctx          context.Context
 	cancel       context.CancelFunc
 }
 
+// chatParticipants хранит закэшированных участников чата
+type chatParticipants struct {
+	userIDs   []string
+	expiresAt time.Time
+}
+
 // EventType определяет тип события WebSocket
 type EventType string
 
 const (
-	EventNewMessage       EventType = "new_message"
-	EventMessageRead      EventType = "message_read"
-	EventMessageDelivered EventType = "message_delivered"
-	EventConnected        EventType = "connected"
-	EventDisconnected     EventType = "disconnected"
-	EventTyping           EventType = "typing"
-	EventStopTyping       EventType = "stop_typing"
-	EventUnreadCount      EventType = "unread_count"
+	EventNewMessage        EventType = "new_message"
+	EventMessageRead       EventType = "message_read"
+	EventMessageDelivered  EventType = "message_delivered"
+	EventConnected         EventType = "connected"
+	EventDisconnected      EventType = "disconnected"
+	EventTyping            EventType = "typing"
+	EventStopTyping        EventType = "stop_typing"
+	EventUnreadCount       EventType = "unread_count"
+	EventTradeUpdated      EventType = "trade_updated"
+	EventReviewPrompt      EventType = "review_prompt"
+	EventTradeReminder     EventType = "trade_reminder"
+	EventTradeCycleUpdated EventType = "trade_cycle_updated"
 )
 
+// MessageReadHandler обрабатывает отметку о прочтении, полученную через WebSocket
+type MessageReadHandler func(chatID, messageID, userID string)
+
 // Event представляет структуру сообщения для WebSocket
 type Event struct {
 	Type      EventType       `json:"type"`
@@ -47,12 +73,46 @@ type Event struct {
 // NewManager создает новый экземпляр Manager
 func NewManager() *Manager {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &Manager{
+	m := &Manager{
 		clients:     make(map[uuid.UUID]*Client),
 		userClients: make(map[string]map[uuid.UUID]bool),
+		chats:       make(map[string]chatParticipants),
+		typing:      make(map[typingKey]*time.Timer),
 		ctx:         ctx,
 		cancel:      cancel,
 	}
+
+	go m.sweepChatCache(chatCacheSweepInterval)
+
+	return m
+}
+
+// sweepChatCache периодически удаляет из кэша истекшие списки участников чатов,
+// иначе кэш растет с каждым чатом, в который когда-либо писали. Останавливается при Shutdown
+func (m *Manager) sweepChatCache(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.chatsMutex.Lock()
+			for chatID, cached := range m.chats {
+				if !now.Before(cached.expiresAt) {
+					delete(m.chats, chatID)
+				}
+			}
+			m.chatsMutex.Unlock()
+		}
+	}
+}
+
+// SetMessageReadHandler задает обработчик событий message_read от клиентов.
+// Вызывается один раз при инициализации сервисов
+func (m *Manager) SetMessageReadHandler(handler MessageReadHandler) {
+	m.onRead = handler
 }
 
 // AddClient регистрирует нового клиента
@@ -85,12 +145,14 @@ func (m *Manager) RemoveClient(clientID uuid.UUID) {
 	userID := client.UserID
 
 	// Удаляем клиент из связи с пользователем
+	lastClient := false
 	m.userMutex.Lock()
 	if clients, ok := m.userClients[userID]; ok {
 		delete(clients, clientID)
 		// Если это был последний клиент пользователя, удаляем запись пользователя
 		if len(clients) == 0 {
 			delete(m.userClients, userID)
+			lastClient = true
 		}
 	}
 	m.userMutex.Unlock()
@@ -100,6 +162,11 @@ func (m *Manager) RemoveClient(clientID uuid.UUID) {
 	delete(m.clients, clientID)
 	m.clientsMutex.Unlock()
 
+	// Пользователь ушел со всех устройств - снимаем его индикаторы печати
+	if lastClient {
+		m.stopUserTyping(userID)
+	}
+
 	log.Printf("WebSocket client %s disconnected for user %s", clientID, userID)
 }
 
@@ -154,16 +221,84 @@ func (m *Manager) SendToUser(userID string, event Event) {
 	}
 }
 
-// SendToChat отправляет сообщение всем участникам чата
+// SendToChat отправляет сообщение всем участникам чата, кроме excludeUserID (обычно отправителя)
 func (m *Manager) SendToChat(chatID string, event Event, excludeUserID string) {
-	// В реальном приложении здесь должна быть логика получения участников чата из БД
-	// и отправки сообщения всем участникам, кроме excludeUserID (обычно отправителя)
+	if chatID == "" {
+		return
+	}
 
-	// Для MVP мы можем упростить и использовать chatID для получения получателя
-	// С учетом того, что у нас уже есть chats и messages таблицы
+	participants, err := m.GetChatParticipants(chatID)
+	if err != nil {
+		log.Printf("Error resolving participants for chat %s: %v", chatID, err)
+		return
+	}
 
-	// TODO: Реализовать логику получения участников чата
-	// и отправки сообщения всем, кроме отправителя
+	if event.ChatID == "" {
+		event.ChatID = chatID
+	}
+
+	for _, userID := range participants {
+		if userID == excludeUserID {
+			continue
+		}
+		m.SendToUser(userID, event)
+	}
+}
+
+// GetChatParticipants возвращает ID участников чата, используя кэш
+func (m *Manager) GetChatParticipants(chatID string) ([]string, error) {
+	m.chatsMutex.RLock()
+	cached, exists := m.chats[chatID]
+	m.chatsMutex.RUnlock()
+
+	if exists && time.Now().Before(cached.expiresAt) {
+		return cached.userIDs, nil
+	}
+
+	ctx, cancel := db.GetContext()
+	defer cancel()
+
+	var senderID, receiverID uuid.UUID
+	err := db.Pool.QueryRow(ctx, `
+		SELECT sender_id, receiver_id FROM chats WHERE id = $1
+	`, chatID).Scan(&senderID, &receiverID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := []string{senderID.String(), receiverID.String()}
+
+	m.chatsMutex.Lock()
+	m.chats[chatID] = chatParticipants{
+		userIDs:   userIDs,
+		expiresAt: time.Now().Add(chatParticipantsTTL),
+	}
+	m.chatsMutex.Unlock()
+
+	return userIDs, nil
+}
+
+// IsChatParticipant проверяет, является ли пользователь участником чата
+func (m *Manager) IsChatParticipant(chatID, userID string) bool {
+	participants, err := m.GetChatParticipants(chatID)
+	if err != nil {
+		return false
+	}
+
+	for _, participantID := range participants {
+		if participantID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// InvalidateChat удаляет участников чата из кэша
+func (m *Manager) InvalidateChat(chatID string) {
+	m.chatsMutex.Lock()
+	delete(m.chats, chatID)
+	m.chatsMutex.Unlock()
 }
 
 // BroadcastUnreadCounts отправляет обновленное количество непрочитанных чатов пользователю
@@ -178,6 +313,39 @@ func (m *Manager) BroadcastUnreadCounts(userID string, unreadCounts int) {
 	})
 }
 
+// CloseSession закрывает соединения, открытые по токенам отозванной сессии
+func (m *Manager) CloseSession(userID, sessionID string) {
+	m.revokeUserClients(userID, func(client *Client) bool {
+		return client.SessionID == sessionID
+	})
+}
+
+// CloseOtherSessions закрывает соединения пользователя, открытые в любой сессии, кроме keepSessionID
+func (m *Manager) CloseOtherSessions(userID, keepSessionID string) {
+	m.revokeUserClients(userID, func(client *Client) bool {
+		return client.SessionID != keepSessionID
+	})
+}
+
+// revokeUserClients закрывает соединения пользователя, для которых match возвращает true
+func (m *Manager) revokeUserClients(userID string, match func(*Client) bool) {
+	m.userMutex.RLock()
+	clientIDs := make([]uuid.UUID, 0, len(m.userClients[userID]))
+	for clientID := range m.userClients[userID] {
+		clientIDs = append(clientIDs, clientID)
+	}
+	m.userMutex.RUnlock()
+
+	m.clientsMutex.RLock()
+	defer m.clientsMutex.RUnlock()
+
+	for _, clientID := range clientIDs {
+		if client, ok := m.clients[clientID]; ok && match(client) {
+			client.Revoke()
+		}
+	}
+}
+
 // Shutdown корректно завершает работу менеджера WebSocket
 func (m *Manager) Shutdown() {
 	m.cancel()
@@ -192,4 +360,10 @@ func (m *Manager) Shutdown() {
 	m.userMutex.Lock()
 	m.userClients = make(map[string]map[uuid.UUID]bool)
 	m.userMutex.Unlock()
+
+	m.chatsMutex.Lock()
+	m.chats = make(map[string]chatParticipants)
+	m.chatsMutex.Unlock()
+
+	m.resetTyping()
 }
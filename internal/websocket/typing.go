@@ -0,0 +1,102 @@
+package websocket
+
+import "time"
+
+// Время, по истечении которого индикатор печати снимается автоматически,
+// если клиент не прислал новое событие typing или stop_typing
+const typingTimeout = 6 * time.Second
+
+// typingKey идентифицирует пользователя, печатающего в конкретном чате
+type typingKey struct {
+	chatID string
+	userID string
+}
+
+// StartTyping отмечает, что пользователь печатает в чате, и оповещает собеседника.
+// Повторные события только продлевают индикатор и не рассылаются заново
+func (m *Manager) StartTyping(chatID, userID string) {
+	key := typingKey{chatID: chatID, userID: userID}
+
+	m.typingMutex.Lock()
+	timer, alreadyTyping := m.typing[key]
+	if alreadyTyping {
+		timer.Stop()
+	}
+
+	var newTimer *time.Timer
+	newTimer = time.AfterFunc(typingTimeout, func() {
+		m.typingMutex.Lock()
+		current, exists := m.typing[key]
+		if !exists || current != newTimer {
+			m.typingMutex.Unlock()
+			return
+		}
+		delete(m.typing, key)
+		m.typingMutex.Unlock()
+
+		m.sendTypingEvent(EventStopTyping, chatID, userID)
+	})
+	m.typing[key] = newTimer
+	m.typingMutex.Unlock()
+
+	if !alreadyTyping {
+		m.sendTypingEvent(EventTyping, chatID, userID)
+	}
+}
+
+// StopTyping снимает индикатор печати и оповещает собеседника
+func (m *Manager) StopTyping(chatID, userID string) {
+	key := typingKey{chatID: chatID, userID: userID}
+
+	m.typingMutex.Lock()
+	timer, exists := m.typing[key]
+	if exists {
+		timer.Stop()
+		delete(m.typing, key)
+	}
+	m.typingMutex.Unlock()
+
+	if exists {
+		m.sendTypingEvent(EventStopTyping, chatID, userID)
+	}
+}
+
+// stopUserTyping снимает все индикаторы печати пользователя (например, при отключении)
+func (m *Manager) stopUserTyping(userID string) {
+	var chatIDs []string
+
+	m.typingMutex.Lock()
+	for key, timer := range m.typing {
+		if key.userID == userID {
+			timer.Stop()
+			delete(m.typing, key)
+			chatIDs = append(chatIDs, key.chatID)
+		}
+	}
+	m.typingMutex.Unlock()
+
+	for _, chatID := range chatIDs {
+		m.sendTypingEvent(EventStopTyping, chatID, userID)
+	}
+}
+
+// sendTypingEvent рассылает событие печати остальным участникам чата
+func (m *Manager) sendTypingEvent(eventType EventType, chatID, userID string) {
+	m.SendToChat(chatID, Event{
+		Type:      eventType,
+		ChatID:    chatID,
+		UserID:    userID,
+		Timestamp: time.Now(),
+	}, userID)
+}
+
+// resetTyping останавливает все таймеры печати без рассылки событий
+func (m *Manager) resetTyping() {
+	m.typingMutex.Lock()
+	defer m.typingMutex.Unlock()
+
+	for key, timer := range m.typing {
+		timer.Stop()
+		delete(m.typing, key)
+	}
+}
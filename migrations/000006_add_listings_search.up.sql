@@ -0,0 +1,10 @@
+-- Полнотекстовый поиск по объявлениям.
+-- Конфигурация 'russian' стеммит кириллицу русским словарем,
+-- а латиницу (asciiword) - английским, поэтому покрывает оба языка
+ALTER TABLE listings ADD COLUMN search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('russian', coalesce(title, '')), 'A') ||
+        setweight(to_tsvector('russian', coalesce(description, '')), 'B')
+    ) STORED;
+
+CREATE INDEX idx_listings_search_vector ON listings USING gin(search_vector);
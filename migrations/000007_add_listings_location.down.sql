@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_listings_coordinates;
+ALTER TABLE listings DROP CONSTRAINT IF EXISTS listings_coordinates_check;
+ALTER TABLE listings
+    DROP COLUMN IF EXISTS city,
+    DROP COLUMN IF EXISTS longitude,
+    DROP COLUMN IF EXISTS latitude;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS longitude,
+    DROP COLUMN IF EXISTS latitude;
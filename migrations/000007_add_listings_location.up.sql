@@ -0,0 +1,19 @@
+-- Координаты пользователя используются по умолчанию для его новых объявлений
+ALTER TABLE users
+    ADD COLUMN latitude DOUBLE PRECISION,
+    ADD COLUMN longitude DOUBLE PRECISION;
+
+-- Местоположение объявления (координаты наружу не отдаются)
+ALTER TABLE listings
+    ADD COLUMN latitude DOUBLE PRECISION,
+    ADD COLUMN longitude DOUBLE PRECISION,
+    ADD COLUMN city VARCHAR(255);
+
+ALTER TABLE listings ADD CONSTRAINT listings_coordinates_check CHECK (
+    (latitude IS NULL AND longitude IS NULL) OR
+    (latitude BETWEEN -90 AND 90 AND longitude BETWEEN -180 AND 180)
+);
+
+-- Индекс для предварительного отбора по ограничивающему прямоугольнику
+CREATE INDEX idx_listings_coordinates ON listings(latitude, longitude)
+WHERE latitude IS NOT NULL;
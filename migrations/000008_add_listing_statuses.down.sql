@@ -0,0 +1 @@
+ALTER TABLE listings DROP CONSTRAINT IF EXISTS listings_status_check;
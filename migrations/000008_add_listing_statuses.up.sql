@@ -0,0 +1,4 @@
+-- Жизненный цикл объявления: draft -> active -> reserved -> traded,
+-- а также archived и expired. Переходы проверяются в приложении
+ALTER TABLE listings ADD CONSTRAINT listings_status_check
+    CHECK (status IN ('draft', 'active', 'reserved', 'traded', 'archived', 'expired'));
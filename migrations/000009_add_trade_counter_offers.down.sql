@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_trades_parent_trade_id;
+ALTER TABLE trades DROP COLUMN IF EXISTS parent_trade_id;
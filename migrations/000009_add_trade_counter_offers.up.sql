@@ -0,0 +1,5 @@
+-- Встречное предложение ссылается на предложение, на которое оно отвечает.
+-- Исходное предложение при этом получает статус countered
+ALTER TABLE trades ADD COLUMN parent_trade_id UUID REFERENCES trades(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_trades_parent_trade_id ON trades(parent_trade_id);
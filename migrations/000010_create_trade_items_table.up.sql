@@ -0,0 +1,20 @@
+-- Объявления, участвующие в обмене, с каждой стороны их может быть несколько.
+-- sender_listing_id и receiver_listing_id в trades хранят первое объявление стороны
+-- для совместимости с клиентами, которые работают с одиночными обменами
+CREATE TABLE trade_items (
+    trade_id UUID NOT NULL REFERENCES trades(id) ON DELETE CASCADE,
+    listing_id UUID NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+    side VARCHAR(10) NOT NULL CHECK (side IN ('sender', 'receiver')),
+    position SMALLINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (trade_id, listing_id)
+);
+
+CREATE INDEX idx_trade_items_listing_id ON trade_items(listing_id);
+
+-- Переносим существующие обмены
+INSERT INTO trade_items (trade_id, listing_id, side)
+SELECT id, sender_listing_id, 'sender' FROM trades;
+
+INSERT INTO trade_items (trade_id, listing_id, side)
+SELECT id, receiver_listing_id, 'receiver' FROM trades
+ON CONFLICT DO NOTHING;
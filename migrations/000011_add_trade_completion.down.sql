@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_trades_accepted_unconfirmed;
+ALTER TABLE trades
+    DROP COLUMN IF EXISTS accepted_at,
+    DROP COLUMN IF EXISTS sender_confirmed_at,
+    DROP COLUMN IF EXISTS receiver_confirmed_at,
+    DROP COLUMN IF EXISTS completed_at,
+    DROP COLUMN IF EXISTS confirmation_overdue_at;
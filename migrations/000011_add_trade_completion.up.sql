@@ -0,0 +1,13 @@
+-- Принятый обмен завершается, когда обе стороны подтвердят, что он состоялся.
+-- confirmation_overdue_at отмечает обмены, которые не подтвердили вовремя
+ALTER TABLE trades
+    ADD COLUMN accepted_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN sender_confirmed_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN receiver_confirmed_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN completed_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN confirmation_overdue_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE trades SET accepted_at = updated_at WHERE status = 'accepted';
+
+CREATE INDEX idx_trades_accepted_unconfirmed ON trades(accepted_at)
+    WHERE status = 'accepted' AND confirmation_overdue_at IS NULL;
@@ -0,0 +1,16 @@
+-- Отзывы участников о завершенном обмене: каждая сторона оставляет не больше одного отзыва
+CREATE TABLE reviews (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    trade_id UUID NOT NULL REFERENCES trades(id) ON DELETE CASCADE,
+    reviewer_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reviewee_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    rating SMALLINT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    comment TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (trade_id, reviewer_id)
+);
+
+-- Индексы для оптимизации запросов
+CREATE INDEX idx_reviews_reviewee_id ON reviews(reviewee_id, created_at DESC);
+CREATE INDEX idx_reviews_reviewer_id ON reviews(reviewer_id);
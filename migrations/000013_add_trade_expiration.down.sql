@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_trades_pending_created_at;
+ALTER TABLE trades DROP COLUMN IF EXISTS reminder_sent_at;
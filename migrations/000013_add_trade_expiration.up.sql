@@ -0,0 +1,5 @@
+-- Ожидающие предложения истекают через настраиваемый срок (статус expired),
+-- незадолго до этого получателю отправляется напоминание
+ALTER TABLE trades ADD COLUMN reminder_sent_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_trades_pending_created_at ON trades(created_at) WHERE status = 'pending';
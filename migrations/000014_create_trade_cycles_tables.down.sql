@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS trade_cycle_participants;
+DROP TABLE IF EXISTS trade_cycles;
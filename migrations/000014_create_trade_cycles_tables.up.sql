@@ -0,0 +1,27 @@
+-- Круговые обмены между 3-4 участниками: каждый отдает свое объявление предыдущему
+-- участнику цикла и получает объявление следующего. Обмен становится активным,
+-- когда его примут все участники
+CREATE TABLE trade_cycles (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    status VARCHAR(20) NOT NULL DEFAULT 'proposed', -- proposed, active, rejected, canceled, expired
+    signature TEXT NOT NULL, -- отсортированные ID объявлений цикла
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE trade_cycle_participants (
+    cycle_id UUID NOT NULL REFERENCES trade_cycles(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    position SMALLINT NOT NULL,
+    gives_listing_id UUID NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+    receives_listing_id UUID NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+    accepted_at TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (cycle_id, user_id)
+);
+
+-- Один и тот же набор объявлений не предлагается повторно, пока цикл открыт
+CREATE UNIQUE INDEX idx_trade_cycles_open_signature ON trade_cycles(signature)
+    WHERE status IN ('proposed', 'active');
+CREATE INDEX idx_trade_cycles_status ON trade_cycles(status);
+CREATE INDEX idx_trade_cycle_participants_user_id ON trade_cycle_participants(user_id);
+CREATE INDEX idx_trade_cycle_participants_gives_listing_id ON trade_cycle_participants(gives_listing_id);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS trade_events;
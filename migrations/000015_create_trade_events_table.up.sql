@@ -0,0 +1,54 @@
+-- Журнал событий обмена: кто и когда создал, принял, отклонил, отменил или завершил обмен.
+-- actor_id пустой, если событие произошло автоматически (например, истек срок)
+CREATE TABLE trade_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    trade_id UUID NOT NULL REFERENCES trades(id) ON DELETE CASCADE,
+    event_type VARCHAR(20) NOT NULL CHECK (event_type IN (
+        'created', 'countered', 'accepted', 'rejected', 'canceled', 'confirmed', 'completed', 'expired'
+    )),
+    actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    data JSONB,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_trade_events_trade_id ON trade_events(trade_id, created_at);
+
+-- Восстанавливаем историю существующих обменов по тому, что сохранилось в trades
+INSERT INTO trade_events (trade_id, event_type, actor_id, data, created_at)
+SELECT id, 'created', sender_id,
+       CASE WHEN parent_trade_id IS NOT NULL THEN jsonb_build_object('parent_trade_id', parent_trade_id) END,
+       created_at
+FROM trades;
+
+INSERT INTO trade_events (trade_id, event_type, actor_id, created_at)
+SELECT id, 'accepted', receiver_id, COALESCE(accepted_at, updated_at)
+FROM trades
+WHERE status IN ('accepted', 'completed');
+
+INSERT INTO trade_events (trade_id, event_type, actor_id, created_at)
+SELECT id, 'confirmed', sender_id, sender_confirmed_at FROM trades WHERE sender_confirmed_at IS NOT NULL
+UNION ALL
+SELECT id, 'confirmed', receiver_id, receiver_confirmed_at FROM trades WHERE receiver_confirmed_at IS NOT NULL;
+
+INSERT INTO trade_events (trade_id, event_type, actor_id, data, created_at)
+SELECT id,
+       CASE status
+           WHEN 'superseded' THEN 'canceled'
+           ELSE status
+       END,
+       CASE status
+           WHEN 'rejected' THEN receiver_id
+           WHEN 'countered' THEN receiver_id
+           WHEN 'canceled' THEN sender_id
+       END,
+       CASE status
+           WHEN 'superseded' THEN jsonb_build_object('reason', 'superseded')
+           WHEN 'countered' THEN jsonb_build_object('counter_trade_id',
+               (SELECT c.id FROM trades c WHERE c.parent_trade_id = trades.id ORDER BY c.created_at LIMIT 1))
+       END,
+       CASE status
+           WHEN 'completed' THEN COALESCE(completed_at, updated_at)
+           ELSE updated_at
+       END
+FROM trades
+WHERE status IN ('rejected', 'canceled', 'superseded', 'countered', 'completed', 'expired');
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_user_sessions_previous_refresh_token_hash;
+DROP INDEX IF EXISTS idx_user_sessions_refresh_token_hash;
+
+ALTER TABLE user_sessions
+    DROP COLUMN IF EXISTS refresh_expires_at,
+    DROP COLUMN IF EXISTS previous_refresh_token_hash,
+    DROP COLUMN IF EXISTS refresh_token_hash;
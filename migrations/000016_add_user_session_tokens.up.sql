@@ -0,0 +1,11 @@
+-- Серверные сессии: каждая сессия хранит хеш текущего refresh-токена.
+-- При обновлении токен меняется, а предыдущий хеш сохраняется, чтобы распознать повторное
+-- использование украденного токена. logout_time отмечает отозванную сессию
+ALTER TABLE user_sessions
+    ADD COLUMN refresh_token_hash VARCHAR(64),
+    ADD COLUMN previous_refresh_token_hash VARCHAR(64),
+    ADD COLUMN refresh_expires_at TIMESTAMP WITH TIME ZONE;
+
+CREATE UNIQUE INDEX idx_user_sessions_refresh_token_hash ON user_sessions(refresh_token_hash);
+CREATE INDEX idx_user_sessions_previous_refresh_token_hash ON user_sessions(previous_refresh_token_hash)
+    WHERE previous_refresh_token_hash IS NOT NULL;
@@ -0,0 +1,20 @@
+DELETE FROM trade_events WHERE cycle_id IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_trade_events_cycle_id;
+ALTER TABLE trade_events
+    DROP CONSTRAINT IF EXISTS trade_events_subject_check,
+    DROP COLUMN IF EXISTS cycle_id,
+    ALTER COLUMN trade_id SET NOT NULL;
+
+DROP INDEX IF EXISTS idx_chats_cycle_id;
+ALTER TABLE chats DROP COLUMN IF EXISTS cycle_id;
+
+DROP INDEX IF EXISTS idx_trade_cycles_active_activated_at;
+
+ALTER TABLE trade_cycle_participants
+    DROP COLUMN IF EXISTS chat_id,
+    DROP COLUMN IF EXISTS confirmed_at;
+
+ALTER TABLE trade_cycles
+    DROP COLUMN IF EXISTS completed_at,
+    DROP COLUMN IF EXISTS activated_at;
@@ -0,0 +1,40 @@
+-- Жизненный цикл активного кругового обмена: участники подтверждают получение объявления,
+-- обмен завершается, когда подтвердили все, или отменяется, если не уложились в срок
+ALTER TABLE trade_cycles
+    ADD COLUMN activated_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN completed_at TIMESTAMP WITH TIME ZONE;
+
+-- Время подтверждения получения и чат участника с тем, кому он отдает объявление
+ALTER TABLE trade_cycle_participants
+    ADD COLUMN confirmed_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN chat_id UUID REFERENCES chats(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_trade_cycles_active_activated_at ON trade_cycles(activated_at) WHERE status = 'active';
+
+-- Чаты между соседними участниками кругового обмена
+ALTER TABLE chats ADD COLUMN cycle_id UUID REFERENCES trade_cycles(id) ON DELETE SET NULL;
+CREATE INDEX idx_chats_cycle_id ON chats(cycle_id);
+
+-- История круговых обменов хранится вместе с историей обычных обменов
+ALTER TABLE trade_events
+    ALTER COLUMN trade_id DROP NOT NULL,
+    ADD COLUMN cycle_id UUID REFERENCES trade_cycles(id) ON DELETE CASCADE,
+    ADD CONSTRAINT trade_events_subject_check CHECK ((trade_id IS NULL) <> (cycle_id IS NULL));
+
+CREATE INDEX idx_trade_events_cycle_id ON trade_events(cycle_id, created_at) WHERE cycle_id IS NOT NULL;
+
+-- Восстанавливаем историю существующих круговых обменов
+INSERT INTO trade_events (cycle_id, event_type, created_at)
+SELECT id, 'created', created_at FROM trade_cycles;
+
+INSERT INTO trade_events (cycle_id, event_type, actor_id, created_at)
+SELECT cycle_id, 'accepted', user_id, accepted_at
+FROM trade_cycle_participants
+WHERE accepted_at IS NOT NULL;
+
+INSERT INTO trade_events (cycle_id, event_type, created_at)
+SELECT id, status, updated_at
+FROM trade_cycles
+WHERE status IN ('rejected', 'canceled', 'expired');
+
+UPDATE trade_cycles SET activated_at = updated_at WHERE status = 'active';
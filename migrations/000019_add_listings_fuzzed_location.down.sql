@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_listings_fuzzed_coordinates;
+CREATE INDEX IF NOT EXISTS idx_listings_coordinates ON listings(latitude, longitude)
+WHERE latitude IS NOT NULL;
+
+ALTER TABLE listings DROP CONSTRAINT IF EXISTS listings_fuzzed_coordinates_check;
+ALTER TABLE listings
+    DROP COLUMN IF EXISTS fuzzed_longitude,
+    DROP COLUMN IF EXISTS fuzzed_latitude;
@@ -0,0 +1,27 @@
+-- Приблизительное местоположение объявления: центр ячейки сетки, в которую попадают точные координаты.
+-- Расстояние, сортировка и фильтр по радиусу считаются только по нему,
+-- поэтому по выдаче нельзя вычислить точку точнее ячейки
+ALTER TABLE listings
+    ADD COLUMN fuzzed_latitude DOUBLE PRECISION,
+    ADD COLUMN fuzzed_longitude DOUBLE PRECISION;
+
+-- Та же сетка, что и в коде: 0.01° по широте, по долготе шаг растягивается на 1/cos(широты)
+UPDATE listings
+SET fuzzed_latitude = LEAST(90, GREATEST(-90, (floor(latitude / 0.01) + 0.5) * 0.01))
+WHERE latitude IS NOT NULL;
+
+UPDATE listings
+SET fuzzed_longitude = LEAST(180, GREATEST(-180,
+    (floor(longitude / (0.01 / GREATEST(cos(radians(fuzzed_latitude)), 0.01))) + 0.5)
+    * (0.01 / GREATEST(cos(radians(fuzzed_latitude)), 0.01))))
+WHERE latitude IS NOT NULL;
+
+ALTER TABLE listings ADD CONSTRAINT listings_fuzzed_coordinates_check CHECK (
+    (latitude IS NULL) = (fuzzed_latitude IS NULL) AND
+    (fuzzed_latitude IS NULL) = (fuzzed_longitude IS NULL)
+);
+
+-- Предварительный отбор по прямоугольнику тоже идет по приблизительным координатам
+DROP INDEX IF EXISTS idx_listings_coordinates;
+CREATE INDEX idx_listings_fuzzed_coordinates ON listings(fuzzed_latitude, fuzzed_longitude)
+WHERE fuzzed_latitude IS NOT NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS users_username_lower_key;
+ALTER TABLE users ADD CONSTRAINT users_username_key UNIQUE (username);
@@ -0,0 +1,13 @@
+-- Имена пользователей уникальны без учета регистра: Alice и alice - одно и то же имя.
+-- Из уже существующих совпадений имя остается у самого раннего пользователя
+UPDATE users u
+SET username = NULL, updated_at = NOW()
+WHERE u.username IS NOT NULL
+  AND EXISTS (
+      SELECT 1 FROM users o
+      WHERE lower(o.username) = lower(u.username)
+        AND (o.created_at, o.id) < (u.created_at, u.id)
+  );
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_username_key;
+CREATE UNIQUE INDEX users_username_lower_key ON users (lower(username));
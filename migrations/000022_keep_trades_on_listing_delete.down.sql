@@ -0,0 +1,25 @@
+-- Обмены и позиции с удаленными объявлениями нельзя вернуть под NOT NULL
+DELETE FROM trade_items WHERE listing_id IS NULL;
+DELETE FROM trades WHERE sender_listing_id IS NULL OR receiver_listing_id IS NULL;
+
+DROP INDEX IF EXISTS trade_items_trade_listing_key;
+ALTER TABLE trade_items
+    DROP CONSTRAINT trade_items_listing_id_fkey,
+    ALTER COLUMN listing_id SET NOT NULL;
+
+ALTER TABLE trade_items
+    ADD CONSTRAINT trade_items_listing_id_fkey
+        FOREIGN KEY (listing_id) REFERENCES listings(id) ON DELETE CASCADE,
+    ADD PRIMARY KEY (trade_id, listing_id);
+
+ALTER TABLE trades
+    DROP CONSTRAINT trades_sender_listing_id_fkey,
+    DROP CONSTRAINT trades_receiver_listing_id_fkey,
+    ALTER COLUMN sender_listing_id SET NOT NULL,
+    ALTER COLUMN receiver_listing_id SET NOT NULL;
+
+ALTER TABLE trades
+    ADD CONSTRAINT trades_sender_listing_id_fkey
+        FOREIGN KEY (sender_listing_id) REFERENCES listings(id) ON DELETE CASCADE,
+    ADD CONSTRAINT trades_receiver_listing_id_fkey
+        FOREIGN KEY (receiver_listing_id) REFERENCES listings(id) ON DELETE CASCADE;
@@ -0,0 +1,27 @@
+-- Удаление объявления больше не удаляет обмены и не меняет их состав молча:
+-- ссылки на удаленное объявление обнуляются, история обмена сохраняется,
+-- а ожидающие предложения с этим объявлением отменяются в коде с записью в истории
+ALTER TABLE trades
+    ALTER COLUMN sender_listing_id DROP NOT NULL,
+    ALTER COLUMN receiver_listing_id DROP NOT NULL,
+    DROP CONSTRAINT trades_sender_listing_id_fkey,
+    DROP CONSTRAINT trades_receiver_listing_id_fkey;
+
+ALTER TABLE trades
+    ADD CONSTRAINT trades_sender_listing_id_fkey
+        FOREIGN KEY (sender_listing_id) REFERENCES listings(id) ON DELETE SET NULL,
+    ADD CONSTRAINT trades_receiver_listing_id_fkey
+        FOREIGN KEY (receiver_listing_id) REFERENCES listings(id) ON DELETE SET NULL;
+
+-- listing_id входил в первичный ключ, поэтому не мог стать NULL.
+-- Уникальность пары сохраняется индексом: строки удаленных объявлений в нем не конфликтуют
+ALTER TABLE trade_items
+    DROP CONSTRAINT trade_items_pkey,
+    DROP CONSTRAINT trade_items_listing_id_fkey;
+
+ALTER TABLE trade_items
+    ALTER COLUMN listing_id DROP NOT NULL,
+    ADD CONSTRAINT trade_items_listing_id_fkey
+        FOREIGN KEY (listing_id) REFERENCES listings(id) ON DELETE SET NULL;
+
+CREATE UNIQUE INDEX trade_items_trade_listing_key ON trade_items(trade_id, listing_id);
@@ -0,0 +1,18 @@
+-- Обмены с удаленными объявлениями нельзя вернуть под NOT NULL
+DELETE FROM trade_cycles c
+WHERE EXISTS (
+    SELECT 1 FROM trade_cycle_participants p
+    WHERE p.cycle_id = c.id AND (p.gives_listing_id IS NULL OR p.receives_listing_id IS NULL)
+);
+
+ALTER TABLE trade_cycle_participants
+    DROP CONSTRAINT trade_cycle_participants_gives_listing_id_fkey,
+    DROP CONSTRAINT trade_cycle_participants_receives_listing_id_fkey,
+    ALTER COLUMN gives_listing_id SET NOT NULL,
+    ALTER COLUMN receives_listing_id SET NOT NULL;
+
+ALTER TABLE trade_cycle_participants
+    ADD CONSTRAINT trade_cycle_participants_gives_listing_id_fkey
+        FOREIGN KEY (gives_listing_id) REFERENCES listings(id) ON DELETE CASCADE,
+    ADD CONSTRAINT trade_cycle_participants_receives_listing_id_fkey
+        FOREIGN KEY (receives_listing_id) REFERENCES listings(id) ON DELETE CASCADE;
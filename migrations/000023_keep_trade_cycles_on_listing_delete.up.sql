@@ -0,0 +1,14 @@
+-- Удаление объявления больше не удаляет участников кругового обмена:
+-- ссылки на удаленное объявление обнуляются, и завершенные и отмененные обмены
+-- остаются в истории всех участников
+ALTER TABLE trade_cycle_participants
+    ALTER COLUMN gives_listing_id DROP NOT NULL,
+    ALTER COLUMN receives_listing_id DROP NOT NULL,
+    DROP CONSTRAINT trade_cycle_participants_gives_listing_id_fkey,
+    DROP CONSTRAINT trade_cycle_participants_receives_listing_id_fkey;
+
+ALTER TABLE trade_cycle_participants
+    ADD CONSTRAINT trade_cycle_participants_gives_listing_id_fkey
+        FOREIGN KEY (gives_listing_id) REFERENCES listings(id) ON DELETE SET NULL,
+    ADD CONSTRAINT trade_cycle_participants_receives_listing_id_fkey
+        FOREIGN KEY (receives_listing_id) REFERENCES listings(id) ON DELETE SET NULL;